@@ -0,0 +1,11 @@
+// Command gormdao is the generic database tool. It doesn't know any models, see the daocli package docs for building a
+// binary with your models.
+package main
+
+import (
+	"github.com/coachbit/gorm-dao/dao/daocli"
+)
+
+func main() {
+	daocli.Main(daocli.App{})
+}
@@ -0,0 +1,100 @@
+package dao
+
+import (
+	"database/sql/driver"
+
+	"github.com/ansel1/merry"
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// FilterIn with more values uses a single array parameter (`column = ANY(?)`) instead of a placeholder per value
+const filterInArrayThreshold = 1000
+
+// StringArray is a model field stored in a text[] column.
+type StringArray []string
+
+func (a StringArray) GormDataType(gorm.Dialect) string { return "text[]" }
+func (a StringArray) Value() (driver.Value, error)     { return pq.StringArray(a).Value() }
+func (a *StringArray) Scan(src interface{}) error {
+	return merry.Wrap((*pq.StringArray)(a).Scan(src))
+}
+
+// Int64Array is a model field stored in a bigint[] column.
+type Int64Array []int64
+
+func (a Int64Array) GormDataType(gorm.Dialect) string { return "bigint[]" }
+func (a Int64Array) Value() (driver.Value, error)     { return pq.Int64Array(a).Value() }
+func (a *Int64Array) Scan(src interface{}) error {
+	return merry.Wrap((*pq.Int64Array)(a).Scan(src))
+}
+
+// UUIDArray is a model field stored in a uuid[] column.
+type UUIDArray []uuid.UUID
+
+func (a UUIDArray) GormDataType(gorm.Dialect) string { return "uuid[]" }
+
+func (a UUIDArray) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	strs := make(pq.StringArray, len(a))
+	for n := range a {
+		strs[n] = a[n].String()
+	}
+	return strs.Value()
+}
+
+func (a *UUIDArray) Scan(src interface{}) error {
+	var strs pq.StringArray
+	if err := strs.Scan(src); err != nil {
+		return merry.Wrap(err)
+	}
+	if strs == nil {
+		*a = nil
+		return nil
+	}
+	res := make(UUIDArray, len(strs))
+	for n := range strs {
+		id, err := uuid.FromString(strs[n])
+		if err != nil {
+			return merry.Wrap(err).Appendf("uuid array element %d", n)
+		}
+		res[n] = id
+	}
+	*a = res
+	return nil
+}
+
+// arrayParam converts slices to postgres array parameters (values which already are sql values are left as they are)
+func arrayParam(values interface{}) interface{} {
+	if _, is := values.(driver.Valuer); is {
+		return values
+	}
+	return pq.Array(values)
+}
+
+// FilterArrayContains filters rows where the array column contains all the values (`column @> ?`).
+func (q *Query) FilterArrayContains(column string, values interface{}) *Query {
+	q.appendFilterExpressionAndValues("filter-array-contains", q.column(column)+" @> ?", arrayParam(values))
+	return q
+}
+
+// FilterArrayOverlaps filters rows where the array column contains any of the values (`column && ?`).
+func (q *Query) FilterArrayOverlaps(column string, values interface{}) *Query {
+	q.appendFilterExpressionAndValues("filter-array-overlaps", q.column(column)+" && ?", arrayParam(values))
+	return q
+}
+
+// FilterArrayAny filters rows where the array column contains the value (`? = ANY(column)`).
+func (q *Query) FilterArrayAny(column string, value interface{}) *Query {
+	q.appendFilterExpressionAndValues("filter-array-any", "? = ANY("+q.column(column)+")", value)
+	return q
+}
+
+// filterInArray is FilterIn with a single array parameter, used for long value lists.
+func (q *Query) filterInArray(column string, values []interface{}) *Query {
+	q.appendFilterExpressionAndValues("filter-in-array", q.column(column)+" = ANY(?)", pq.Array(values))
+	return q
+}
@@ -0,0 +1,152 @@
+package dao
+
+import (
+	"path"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Column is a model's database column (see GenerateColumns).
+type Column struct {
+	Table string
+	Name  string
+	// GoType is qualified with the package name, not the import path (`dao.JSONB[appmodels.Settings]`)
+	GoType string
+}
+
+func (c Column) String() string {
+	return c.Name
+}
+
+// Qualified returns the column name prefixed with the table name.
+func (c Column) Qualified() string {
+	return c.Table + "." + c.Name
+}
+
+// goTypeName is the type's name with package names instead of import paths (also in generic type arguments).
+func goTypeName(ty reflect.Type) string {
+	return qualifiedTypeRegexp.ReplaceAllStringFunc(ty.String(), func(qualified string) string {
+		dot := strings.LastIndex(qualified, ".")
+		return path.Base(qualified[:dot]) + qualified[dot:]
+	})
+}
+
+// Predicate is a filter expression built from typed columns, see Query.Where.
+type Predicate struct {
+	expr   string
+	values []interface{}
+}
+
+func NewPredicate(expr string, values ...interface{}) Predicate {
+	return Predicate{expr: expr, values: values}
+}
+
+func (p Predicate) String() string {
+	return p.expr
+}
+
+// Or combines predicates with "or".
+func Or(preds ...Predicate) Predicate {
+	return combinePredicates(" or ", preds...)
+}
+
+// And combines predicates with "and" (needed only within Or, Query.Where already combines its arguments with "and").
+func And(preds ...Predicate) Predicate {
+	return combinePredicates(" and ", preds...)
+}
+
+func Not(pred Predicate) Predicate {
+	return Predicate{expr: "not (" + pred.expr + ")", values: pred.values}
+}
+
+func combinePredicates(operator string, preds ...Predicate) Predicate {
+	var res Predicate
+	for n, p := range preds {
+		if n > 0 {
+			res.expr += operator
+		}
+		res.expr += "(" + p.expr + ")"
+		res.values = append(res.values, p.values...)
+	}
+	return res
+}
+
+// TypedColumn builds predicates with values checked by the compiler.
+type TypedColumn[T any] struct {
+	Column
+}
+
+func NewTypedColumn[T any](table, name string) TypedColumn[T] {
+	var t *T
+	return TypedColumn[T]{Column: Column{Table: table, Name: name, GoType: goTypeName(reflect.TypeOf(t).Elem())}}
+}
+
+func (tc TypedColumn[T]) compare(operator string, value T) Predicate {
+	return Predicate{expr: tc.Name + " " + operator + " ?", values: []interface{}{value}}
+}
+
+func (tc TypedColumn[T]) Eq(value T) Predicate  { return tc.compare("=", value) }
+func (tc TypedColumn[T]) Ne(value T) Predicate  { return tc.compare("<>", value) }
+func (tc TypedColumn[T]) Lt(value T) Predicate  { return tc.compare("<", value) }
+func (tc TypedColumn[T]) Lte(value T) Predicate { return tc.compare("<=", value) }
+func (tc TypedColumn[T]) Gt(value T) Predicate  { return tc.compare(">", value) }
+func (tc TypedColumn[T]) Gte(value T) Predicate { return tc.compare(">=", value) }
+
+func (tc TypedColumn[T]) In(values ...T) Predicate {
+	return tc.in("in", values...)
+}
+
+func (tc TypedColumn[T]) NotIn(values ...T) Predicate {
+	return tc.in("not in", values...)
+}
+
+func (tc TypedColumn[T]) in(operator string, values ...T) Predicate {
+	if len(values) == 0 {
+		// "in ()" is invalid sql
+		if operator == "in" {
+			return Predicate{expr: "1 = 0"}
+		}
+		return Predicate{expr: "1 = 1"}
+	}
+	vals := make([]interface{}, len(values))
+	for n := range values {
+		vals[n] = values[n]
+	}
+	return Predicate{expr: tc.Name + " " + operator + " (" + strings.TrimSuffix(strings.Repeat("?,", len(values)), ",") + ")", values: vals}
+}
+
+func (tc TypedColumn[T]) IsNull() Predicate {
+	return Predicate{expr: tc.Name + " is null"}
+}
+
+func (tc TypedColumn[T]) IsNotNull() Predicate {
+	return Predicate{expr: tc.Name + " is not null"}
+}
+
+type StringColumn struct {
+	TypedColumn[string]
+}
+
+func NewStringColumn(table, name string) StringColumn {
+	return StringColumn{TypedColumn: NewTypedColumn[string](table, name)}
+}
+
+func (sc StringColumn) Like(pattern string) Predicate  { return sc.compare("like", pattern) }
+func (sc StringColumn) ILike(pattern string) Predicate { return sc.compare("ilike", pattern) }
+
+type TimeColumn struct {
+	TypedColumn[time.Time]
+}
+
+func NewTimeColumn(table, name string) TimeColumn {
+	return TimeColumn{TypedColumn: NewTypedColumn[time.Time](table, name)}
+}
+
+func (tc TimeColumn) After(t time.Time) Predicate  { return tc.Gt(t) }
+func (tc TimeColumn) Before(t time.Time) Predicate { return tc.Lt(t) }
+
+// Between is inclusive on both ends.
+func (tc TimeColumn) Between(from, to time.Time) Predicate {
+	return Predicate{expr: tc.Name + " between ? and ?", values: []interface{}{from, to}}
+}
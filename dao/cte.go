@@ -0,0 +1,104 @@
+package dao
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/ansel1/merry"
+	"github.com/jinzhu/gorm"
+)
+
+// cteNameRegexp matches CTE names, optionally with column names (`tree(id, parent_id, depth)`)
+var cteNameRegexp = regexp.MustCompile(`^([a-zA-Z_]\w*)\s*(\(\s*[a-zA-Z_]\w*(\s*,\s*[a-zA-Z_]\w*)*\s*\))?$`)
+
+type cte struct {
+	name      string
+	sql       string
+	values    []interface{}
+	recursive bool
+}
+
+// With adds a common table expression built from another query (not paged unless its page size is set explicitly). The
+// CTE can be used in filters (`id in (select user_id from active_subscriptions)`) or as the source, see FromCTE().
+func (q *Query) With(name string, sub *Query, sample Model) *Query {
+	if sub.err != nil {
+		q.err = sub.err
+		return q
+	}
+	sql, values, err := sub.renderQuery(queryModeSubquery, sample)
+	if err != nil {
+		q.err = err
+		return q
+	}
+	return q.addCTE(cte{name: name, sql: sql, values: values})
+}
+
+// WithRaw adds a common table expression from raw sql.
+func (q *Query) WithRaw(name, sql string, values ...interface{}) *Query {
+	return q.addCTE(cte{name: name, sql: sql, values: values})
+}
+
+// WithRecursive adds a recursive common table expression, the sql is usually `<anchor> union all <recursive term>`:
+//
+//	q.WithRecursive("tree", `select * from orgs where id = ? union all select orgs.* from orgs join tree on orgs.parent_id = tree.id`, rootID).
+//		FromCTE("tree").
+//		All(&orgs)
+func (q *Query) WithRecursive(name, sql string, values ...interface{}) *Query {
+	return q.addCTE(cte{name: name, sql: sql, values: values, recursive: true})
+}
+
+func (q *Query) addCTE(c cte) *Query {
+	if !cteNameRegexp.MatchString(c.name) {
+		q.err = merry.New("invalid cte name").Appendf("name: %s", c.name)
+		return q
+	}
+	if strings.Count(c.sql, "?") != len(c.values) {
+		q.err = merry.New("invalid expression placeholders count").Appendf("'%s' params: %#v", c.sql, c.values)
+		return q
+	}
+	q.logStr = append(q.logStr, "with:"+c.name)
+	q.ctes = append(q.ctes, c)
+	return q
+}
+
+// FromCTE selects rows from the CTE instead of the model's table. The CTE is aliased with the table name, so filters
+// with table-qualified columns still work. Soft deleted rows are not filtered here (the CTE must do that if needed).
+func (q *Query) FromCTE(name string) *Query {
+	q.logStr = append(q.logStr, "from:"+name)
+	q.fromCTE = name
+	return q
+}
+
+// tableName is the name without the column list
+func (c cte) tableName() string {
+	return cteNameRegexp.FindStringSubmatch(c.name)[1]
+}
+
+// fromCTEDb replaces the model's table with the CTE set with FromCTE()
+func (q *Query) fromCTEDb(db *gorm.DB, sample interface{}) (*gorm.DB, error) {
+	if q.fromCTE == "" {
+		return db, nil
+	}
+	for _, c := range q.ctes {
+		if c.tableName() == q.fromCTE {
+			return db.Unscoped().Table(q.fromCTE + " AS " + q.gormDb.NewScope(sample).QuotedTableName()), nil
+		}
+	}
+	return nil, merry.New("unknown cte").Appendf("from %s", q.fromCTE)
+}
+
+// withClause renders the `WITH` prefix, if any CTE is recursive the whole clause must be `WITH RECURSIVE`.
+func (q *Query) withClause() (string, []interface{}) {
+	recursive := false
+	parts := make([]string, len(q.ctes))
+	var values []interface{}
+	for n, c := range q.ctes {
+		recursive = recursive || c.recursive
+		parts[n] = c.name + " AS (" + c.sql + ")"
+		values = append(values, c.values...)
+	}
+	if recursive {
+		return "WITH RECURSIVE " + strings.Join(parts, ", ") + " ", values
+	}
+	return "WITH " + strings.Join(parts, ", ") + " ", values
+}
@@ -1,7 +1,6 @@
 package dao
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"io/ioutil"
@@ -12,7 +11,6 @@ import (
 	"time"
 
 	"github.com/ansel1/merry"
-	utils "github.com/coachbit/gorm-dao/dao/daoutils"
 	"github.com/coachbit/gorm-dao/dao/stats"
 	"github.com/gofrs/uuid"
 	"github.com/lib/pq"
@@ -69,6 +67,40 @@ type DbStatsCollector interface {
 	AddStats(c context.Context, since time.Time, queryFmt string, params ...interface{})
 }
 
+// DbOutcomeRecorder is optionally implemented by DbStatsCollectors which record the outcome and number of rows of
+// queries (see stats.StatsCollector), AddStats is used for the others.
+type DbOutcomeRecorder interface {
+	Record(c context.Context, since time.Time, res stats.Result, queryFmt string, params ...interface{})
+}
+
+// recordStats records the outcome if the collector is a DbOutcomeRecorder, nil collectors (also typed nil pointers)
+// are ignored.
+func recordStats(collector DbStatsCollector, c context.Context, since time.Time, err error, rows int64, queryFmt string, params ...interface{}) {
+	if collector == nil {
+		return
+	}
+	if v := reflect.ValueOf(collector); v.Kind() == reflect.Ptr && v.IsNil() {
+		return
+	}
+	if recorder, is := collector.(DbOutcomeRecorder); is {
+		recorder.Record(c, since, statsResult(err, rows), queryFmt, params...)
+		return
+	}
+	collector.AddStats(c, since, queryFmt, params...)
+}
+
+func statsResult(err error, rows int64) stats.Result {
+	switch {
+	case err == nil:
+		return stats.Result{Outcome: stats.OutcomeOK, Rows: rows}
+	case IsRecordNotFound(err):
+		return stats.Result{Outcome: stats.OutcomeNotFound, Rows: 0}
+	case IsUniqueConstraintError(err):
+		return stats.Result{Outcome: stats.OutcomeUniqueViolation, Rows: 0}
+	}
+	return stats.Result{Outcome: stats.OutcomeError, Rows: -1}
+}
+
 type Model interface {
 	GetID() uuid.UUID
 	GenerateID()
@@ -94,6 +126,9 @@ func New(version string, database string, connectionString string, models ...int
 type Dao struct {
 	Logger         Logger                `inject:""`
 	StatsCollector *stats.StatsCollector `inject:"db_stats"`
+	Tracer         Tracer
+	// SQLLogger (if set) receives structured sql logs instead of Logger.Debugf
+	SQLLogger StructuredLogger
 
 	version          string
 	database         string
@@ -101,32 +136,25 @@ type Dao struct {
 	models           []interface{}
 
 	Debug bool
+	// SkipMigrations disables AutoMigrate of models in Init() and index creation in AddIndex/AddUniqueIndex (indexes
+	// are only registered), see AutoMigrate()
+	SkipMigrations bool
 
 	masterGormDb *gorm.DB
 
 	initialStatements       []string
 	userMsgsByUniqueIndexes map[string]string
+	redactedColumns         map[string]bool
+	indexes                 []IndexInfo
 
-	modelListenersMutex sync.RWMutex
-	modelListeners      map[reflect.Type][]ListenerFunc
-}
+	offlineDbOnce sync.Once
+	offlineDb     *gorm.DB
 
-func (d *Dao) DbInfo(c context.Context) (string, error) {
-	rows, err := d.Query(c).RawRows(`select uv.a tablename, pg_size_pretty(uv.b) sizepretty from (select tb.tablename a, pg_table_size('public.'||tb.tablename::text) b from pg_tables tb where tb.schemaname ilike 'public' order by 2 desc) uv`)
-	if err != nil {
-		return "", err
-	}
-	defer utils.CloseCloser(rows)
+	knownColumnsOnce sync.Once
+	knownColumns     map[string]bool
 
-	res := ""
-	for rows.Next() {
-		var table, size string
-		if err := rows.Scan(&table, &size); err != nil {
-			return "", err
-		}
-		res += fmt.Sprintf("%30s: %s\n", table, size)
-	}
-	return res, nil
+	modelListenersMutex sync.RWMutex
+	modelListeners      map[reflect.Type][]ListenerFunc
 }
 
 func (d *Dao) IsRecordNotFound(err error) bool {
@@ -155,7 +183,7 @@ func (d *Dao) initDb(c context.Context) (*gorm.DB, error) {
 	d.Logger.Infof(c, "Database connected")
 	d.userMsgsByUniqueIndexes = map[string]string{}
 
-	if d.Debug {
+	if d.Debug || d.SQLLogger != nil {
 		gormDb.LogMode(true)
 		//d.gormDb.SetLogger(gorm.Logger{revel.TRACE})
 		gormDb.SetLogger(d)
@@ -163,15 +191,6 @@ func (d *Dao) initDb(c context.Context) (*gorm.DB, error) {
 
 	gormDb.BlockGlobalUpdate(true)
 
-	dbVersionFile := "./.coachbit_db_version"
-	byts, _ := ioutil.ReadFile(dbVersionFile)
-	defer func() {
-		_ = os.Remove(dbVersionFile)
-		if err := ioutil.WriteFile(dbVersionFile, []byte(d.version), 0700); err != nil {
-			d.Logger.Errf(c, err, "error saving db version file")
-		}
-	}()
-
 	for _, stmt := range d.initialStatements {
 		rawDb := db.DB()
 		rs, err := rawDb.Exec(stmt)
@@ -183,6 +202,20 @@ func (d *Dao) initDb(c context.Context) (*gorm.DB, error) {
 		d.Logger.Infof(c, "rs: %#v", rs)
 	}
 
+	if d.SkipMigrations {
+		d.Logger.Infof(c, "Models migrations skipped")
+		return gormDb, nil
+	}
+
+	dbVersionFile := "./.coachbit_db_version"
+	byts, _ := ioutil.ReadFile(dbVersionFile)
+	defer func() {
+		_ = os.Remove(dbVersionFile)
+		if err := ioutil.WriteFile(dbVersionFile, []byte(d.version), 0700); err != nil {
+			d.Logger.Errf(c, err, "error saving db version file")
+		}
+	}()
+
 	d.Logger.Infof(c, "Initializing models")
 	for _, model := range d.models {
 		if d.version == string(byts) {
@@ -198,6 +231,44 @@ func (d *Dao) initDb(c context.Context) (*gorm.DB, error) {
 	return gormDb, nil
 }
 
+// AutoMigrate migrates all models (regardless of the version) and creates the registered indexes.
+func (d *Dao) AutoMigrate(c context.Context) error {
+	for _, model := range d.models {
+		d.Logger.Infof(c, "migrating %T", model)
+		if err := d.masterGormDb.AutoMigrate(model).Error; err != nil {
+			return merry.Wrap(err).Appendf("migrating %T", model)
+		}
+	}
+	for _, idx := range d.indexes {
+		if err := d.createIndex(idx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Exec executes a statement without results (for example DDL), and returns the number of affected rows.
+func (d *Dao) Exec(c context.Context, sql string, values ...interface{}) (rows int64, err error) {
+	return d.ExecLabeled(c, sql, sql, values...)
+}
+
+// ExecLabeled is Exec for long statements (like migration files), the short label (for example
+// `migration:0001_users`) is used instead of the sql in the stats, spans and errors.
+func (d *Dao) ExecLabeled(c context.Context, label, sql string, values ...interface{}) (rows int64, err error) {
+	started := time.Now()
+	span := startSpan(c, d.Tracer, d.masterGormDb, rawOperation(sql), nil, label)
+	defer func() {
+		d.addStats(c, started, err, rows, "exec:%s", label)
+		endSpan(span, err, rows)
+	}()
+
+	q := d.db(c).Exec(sql, values...)
+	if err := q.Error; err != nil {
+		return 0, merry.Wrap(err).Appendf("sql: %v, values= %#v", label, values)
+	}
+	return q.RowsAffected, nil
+}
+
 func (d *Dao) AddListener(m Model, lstnr ListenerFunc) {
 	ty := reflect.TypeOf(m)
 	d.modelListenersMutex.Lock()
@@ -209,24 +280,102 @@ func (d *Dao) AddInitialStatements(c context.Context, statement string) {
 	d.initialStatements = append(d.initialStatements, statement)
 }
 
-func (d *Dao) AddUniqueIndex(c context.Context, index, validationMsg string, model Model, columns ...string) error {
-	d.userMsgsByUniqueIndexes[index] = validationMsg
-	if err := d.masterGormDb.Model(model).AddUniqueIndex(index, columns...).Error; err != nil {
-		if strings.Contains(err.Error(), "relation") && strings.Contains(err.Error(), "already exists") {
-			return nil
+// IndexInfo is an index registered with AddIndex or AddUniqueIndex.
+type IndexInfo struct {
+	Name          string
+	Table         string
+	Columns       []string
+	Unique        bool
+	ValidationMsg string
+	// Method is the index access method (for example "gin"), btree if empty
+	Method string
+	// OpClass is the operator class used for all columns (for example "gin_trgm_ops")
+	OpClass string
+	// Expression is the indexed expression, used instead of the columns (which are then only informative)
+	Expression string
+}
+
+// Indexes returns all indexes registered with AddIndex, AddUniqueIndex, AddTrigramIndex or AddFulltextColumn.
+func (d *Dao) Indexes() []IndexInfo {
+	return append([]IndexInfo(nil), d.indexes...)
+}
+
+// registerIndex adds the index, or replaces the one with the same name (e.g. if the migrations run again).
+func (d *Dao) registerIndex(idx IndexInfo) IndexInfo {
+	d.userMsgsByUniqueIndexes[idx.Name] = idx.ValidationMsg
+	for n := range d.indexes {
+		if d.indexes[n].Name == idx.Name {
+			d.indexes[n] = idx
+			return idx
 		}
-		return merry.Wrap(err).Appendf("adding index %s", index)
 	}
-	return nil
+	d.indexes = append(d.indexes, idx)
+	return idx
 }
 
+// metaDb is used for model metadata (table names, columns), it works before Init() too.
+func (d *Dao) metaDb() *gorm.DB {
+	if d.masterGormDb != nil {
+		return d.masterGormDb
+	}
+	d.offlineDbOnce.Do(func() {
+		var err error
+		if d.offlineDb, err = offlineGormDb(d.database); err != nil {
+			d.offlineDb, _ = offlineGormDb(defaultDialect)
+		}
+	})
+	return d.offlineDb
+}
+
+// AddUniqueIndex registers and creates the index (only registers, if SkipMigrations is set).
+func (d *Dao) AddUniqueIndex(c context.Context, index, validationMsg string, model Model, columns ...string) error {
+	idx := d.registerIndex(IndexInfo{
+		Name:          index,
+		Table:         d.metaDb().NewScope(model).TableName(),
+		Columns:       columns,
+		Unique:        true,
+		ValidationMsg: validationMsg,
+	})
+	if d.SkipMigrations {
+		return nil
+	}
+	return d.createIndex(idx)
+}
+
+// AddIndex registers and creates the index (only registers, if SkipMigrations is set).
 func (d *Dao) AddIndex(c context.Context, index, validationMsg string, model Model, columns ...string) error {
-	d.userMsgsByUniqueIndexes[index] = validationMsg
-	if err := d.masterGormDb.Model(model).AddIndex(index, columns...).Error; err != nil {
+	idx := d.registerIndex(IndexInfo{
+		Name:          index,
+		Table:         d.metaDb().NewScope(model).TableName(),
+		Columns:       columns,
+		ValidationMsg: validationMsg,
+	})
+	if d.SkipMigrations {
+		return nil
+	}
+	return d.createIndex(idx)
+}
+
+func (d *Dao) createIndex(idx IndexInfo) error {
+	if idx.Method != "" || idx.OpClass != "" || idx.Expression != "" {
+		// gorm can't create indexes with access methods, operator classes or expressions
+		sql := strings.Replace(strings.TrimSuffix(createIndexSQL(idx), ";"), "INDEX", "INDEX IF NOT EXISTS", 1)
+		if err := d.masterGormDb.Exec(sql).Error; err != nil {
+			return merry.Wrap(err).Appendf("adding index %s", idx.Name)
+		}
+		return nil
+	}
+	db := d.masterGormDb.Table(idx.Table)
+	if idx.Unique {
+		db = db.AddUniqueIndex(idx.Name, idx.Columns...)
+	} else {
+		db = db.AddIndex(idx.Name, idx.Columns...)
+	}
+	if err := db.Error; err != nil {
 		if strings.Contains(err.Error(), "relation") && strings.Contains(err.Error(), "already exists") {
 			return nil
 		}
-		return merry.Wrap(err).Appendf("adding index %s", index)
+		return merry.Wrap(err).Appendf("adding index %s", idx.Name)
 	}
 	return nil
 }
@@ -241,22 +390,35 @@ func (d *Dao) Clean() error {
 
 // Print is used to log sql statements (implementation of gorm.logger)
 func (d *Dao) Print(v ...interface{}) {
-	// unfortunately, we have no context.Context for the original db operation
-	var byts bytes.Buffer
-	for _, msg := range gorm.LogFormatter(v...) {
-		byts.WriteString(strings.TrimSpace(fmt.Sprintf("%v", msg)))
-		byts.WriteRune(' ')
+	// no context.Context here, operations executed with d.db(c) are logged with their context
+	d.print(context.Background(), v...)
+}
+
+// db returns the gorm db for one operation, with sql logged using the operation's context.
+func (d *Dao) db(c context.Context) *gorm.DB {
+	if d.masterGormDb == nil {
+		return nil
 	}
-	c := context.Background()
-	d.Logger.Debugf(c, byts.String())
+	db := d.masterGormDb.New()
+	if d.Debug || d.SQLLogger != nil {
+		db.SetLogger(contextLogger{d: d, c: c})
+	}
+	return db
 }
 
 func (d *Dao) Query(c context.Context) *Query {
+	db := d.db(c) // for queries we can use slave later
+	if db == nil {
+		// not initialized, the query can be used only for rendering sql (see Query.ToSQL())
+		db = d.metaDb().New()
+	}
 	return &Query{
 		c:              c,
-		gormDb:         d.masterGormDb, // for queries we can use slave later
+		gormDb:         db,
 		logger:         d.Logger,
 		statsCollector: d.StatsCollector,
+		tracer:         d.Tracer,
+		knownColumns:   d.columnWhitelist(),
 	}
 }
 
@@ -294,12 +456,17 @@ func (d *Dao) UpdateColumns(c context.Context, model Model, ci ...ColumnInfo) er
 	return d.UpdateColumnValues(c, model, vals)
 }
 
-func (d *Dao) UpdateColumnValues(c context.Context, model Model, cols map[string]interface{}) error {
+func (d *Dao) UpdateColumnValues(c context.Context, model Model, cols map[string]interface{}) (err error) {
 	if err := d.assertIDValid(c, model); err != nil {
 		return err
 	}
 	started := time.Now()
-	defer d.StatsCollector.AddStats(c, started, "updating %T", model)
+	var rows int64
+	span := startSpan(c, d.Tracer, d.masterGormDb, "UPDATE", model, "")
+	defer func() {
+		d.addStats(c, started, err, rows, "updating %T", model)
+		endSpan(span, err, rows)
+	}()
 
 	hctx := d.newHookCtx(cols, false)
 	d.executeHookListeners(c, model, BeforeUpdate, &hctx)
@@ -307,10 +474,15 @@ func (d *Dao) UpdateColumnValues(c context.Context, model Model, cols map[string
 	if !d.masterGormDb.HasBlockGlobalUpdate() {
 		return merry.New("no global updates allowed")
 	}
-	q := d.masterGormDb.Model(model).Update(cols)
+	values, err := jsonPatchExprs(cols)
+	if err != nil {
+		return err
+	}
+	q := d.db(c).Model(model).Update(values)
 	if err := q.Error; err != nil {
 		return d.extractUniqueMessages(c, err)
 	}
+	rows = q.RowsAffected
 	if q.RowsAffected > 1 {
 		d.Logger.Criticalf(c, "Expected 1 update, got %d", q.RowsAffected)
 		return merry.New("!")
@@ -319,19 +491,25 @@ func (d *Dao) UpdateColumnValues(c context.Context, model Model, cols map[string
 	return nil
 }
 
-func (d *Dao) Delete(c context.Context, m Model) error {
+func (d *Dao) Delete(c context.Context, m Model) (err error) {
 	if err := d.assertIDValid(c, m); err != nil {
 		return err
 	}
 	started := time.Now()
-	defer d.StatsCollector.AddStats(c, started, "hard deleting %T", m)
+	var rows int64
+	span := startSpan(c, d.Tracer, d.masterGormDb, "DELETE", m, "")
+	defer func() {
+		d.addStats(c, started, err, rows, "hard deleting %T", m)
+		endSpan(span, err, rows)
+	}()
 
 	hctx := d.newHookCtx(nil, false)
 
-	q := d.masterGormDb.Unscoped().Delete(m)
+	q := d.db(c).Unscoped().Delete(m)
 	if err := q.Error; err != nil {
 		return merry.Wrap(err).Appendf("deleting %T", m)
 	}
+	rows = q.RowsAffected
 	if q.RowsAffected > 1 {
 		d.Logger.Criticalf(c, "Expected 1 update, got %d", q.RowsAffected)
 		return merry.New(fmt.Sprintf("Expected 1 update, got %d", q.RowsAffected))
@@ -340,6 +518,12 @@ func (d *Dao) Delete(c context.Context, m Model) error {
 	return nil
 }
 
+// addStats is used for operations executing sql (the ones wrapping a Query are recorded by the Query itself)
+func (d *Dao) addStats(c context.Context, started time.Time, err error, rows int64, queryFmt string, params ...interface{}) {
+	recordQuery(c, fmt.Sprintf(queryFmt, params...))
+	recordStats(d.StatsCollector, c, started, err, rows, queryFmt, params...)
+}
+
 // assertIDValid must be called on every update/delete that must be executed on only row. Otherwise if ID
 // is a zero value GORM executes a global UPDATE!!!!!!!
 func (d *Dao) assertIDValid(c context.Context, m Model) error {
@@ -375,7 +559,7 @@ func (d *Dao) CreateOrUpdateColumns(c context.Context, m Model, ci ...ColumnInfo
 	return d.UpdateColumns(c, m, ci...)
 }
 
-func (d *Dao) CreateOrUpdate(c context.Context, m Model) error {
+func (d *Dao) CreateOrUpdate(c context.Context, m Model) (err error) {
 	if m == nil {
 		return merry.New("nil model")
 	}
@@ -384,14 +568,21 @@ func (d *Dao) CreateOrUpdate(c context.Context, m Model) error {
 	}
 
 	started := time.Now()
-	defer d.StatsCollector.AddStats(c, started, "updating %T", m)
+	var rows int64
+	span := startSpan(c, d.Tracer, d.masterGormDb, "UPDATE", m, "")
+	defer func() {
+		d.addStats(c, started, err, rows, "updating %T", m)
+		endSpan(span, err, rows)
+	}()
 
 	hctx := d.newHookCtx(nil, true)
 	d.executeHookListeners(c, m, BeforeUpdate, &hctx)
 
-	if err := d.masterGormDb.Save(m).Error; err != nil {
+	q := d.db(c).Save(m)
+	if err := q.Error; err != nil {
 		return merry.Wrap(err).Appendf("saving %T", m)
 	}
+	rows = q.RowsAffected
 
 	d.executeHookListeners(c, m, AfterUpdate, &hctx)
 
@@ -410,7 +601,7 @@ func (d *Dao) CreateMulti(c context.Context, modls ...Model) error {
 	return grp.Wait()
 }
 
-func (d *Dao) Create(c context.Context, m Model) error {
+func (d *Dao) Create(c context.Context, m Model) (err error) {
 	if m == nil {
 		return merry.New("nil model")
 	}
@@ -418,24 +609,32 @@ func (d *Dao) Create(c context.Context, m Model) error {
 		return merry.New(fmt.Sprintf("inserting an existing object, %T with %s", m, m.GetID()))
 	}
 	started := time.Now()
-	defer d.StatsCollector.AddStats(c, started, "creating %T", m)
+	var rows int64
+	span := startSpan(c, d.Tracer, d.masterGormDb, "INSERT", m, "")
+	defer func() {
+		d.addStats(c, started, err, rows, "creating %T", m)
+		endSpan(span, err, rows)
+	}()
 
 	m.GenerateID()
 	hctx := d.newHookCtx(nil, true)
 	d.executeHookListeners(c, m, BeforeCreate, &hctx)
-	if err := d.masterGormDb.Create(m).Error; err != nil {
+	q := d.db(c).Create(m)
+	if err := q.Error; err != nil {
 		return d.extractUniqueMessages(c, err)
 	}
+	rows = q.RowsAffected
 	d.executeHookListeners(c, m, AfterCreate, &hctx)
 	return nil
 }
 
-func (d *Dao) Load(c context.Context, m Model) error {
+func (d *Dao) Load(c context.Context, m Model) (err error) {
 	if m.IsIDNil() {
 		return merry.New(fmt.Sprintf("nil id %T", m))
 	}
 	started := time.Now()
-	defer d.StatsCollector.AddStats(c, started, "loading %T", m)
+	// the rows are only used if there's no error
+	defer func() { recordStats(d.StatsCollector, c, started, err, 1, "loading %T", m) }()
 	return d.Query(c).Filter("id", "=", m.GetID()).First(m)
 }
 
@@ -459,21 +658,21 @@ func (d *Dao) Reload(c context.Context, models ...Model) error {
 	return nil
 }
 
-func (d *Dao) ByID(c context.Context, m Model, id uuid.UUID) error {
+func (d *Dao) ByID(c context.Context, m Model, id uuid.UUID) (err error) {
 	if uuid.Nil == id {
 		return merry.New(fmt.Sprintf("nil id %T", m))
 	}
 	started := time.Now()
-	defer d.StatsCollector.AddStats(c, started, "getting %T", m)
+	defer func() { recordStats(d.StatsCollector, c, started, err, 1, "getting %T", m) }()
 	return d.Query(c).Filter("id", "=", id).First(m)
 }
 
-func (d *Dao) GetDeletedByID(c context.Context, m Model, id uuid.UUID) error {
+func (d *Dao) GetDeletedByID(c context.Context, m Model, id uuid.UUID) (err error) {
 	if uuid.Nil == id {
 		return merry.New(fmt.Sprintf("nil id %T", m))
 	}
 	started := time.Now()
-	defer d.StatsCollector.AddStats(c, started, "getting %T", m)
+	defer func() { recordStats(d.StatsCollector, c, started, err, 1, "getting %T", m) }()
 
 	return d.Query(c).IncludeDeleted().Filter("id", "=", id).First(m)
 }
@@ -24,11 +24,14 @@ const defaultPageSize = 50
 type QueryIterator struct {
 	db   *gorm.DB
 	rows *sql.Rows
+	span *iteratorSpan
 }
 
 func (qi QueryIterator) Next() bool {
 	next := qi.rows.Next()
-	if !next {
+	if next {
+		qi.span.next()
+	} else {
 		qi.Close()
 	}
 	return next
@@ -46,6 +49,7 @@ func (qi QueryIterator) Close() {
 	if err := qi.rows.Close(); err != nil {
 		fmt.Fprintf(os.Stderr, "error closing rows: %#v", err)
 	}
+	qi.span.end(qi.rows.Err())
 }
 
 type exprValue struct {
@@ -61,6 +65,7 @@ type Query struct {
 	logger         Logger
 	c              context.Context
 	statsCollector DbStatsCollector
+	tracer         Tracer
 	err            error
 
 	pageNo         int
@@ -68,10 +73,31 @@ type Query struct {
 	includeDeleted bool
 	logStr         []string
 
+	// lookahead rows are loaded beyond the page (see Page())
+	lookahead int
+	pageTotal PageTotal
+
 	expressions []string
 	values      []interface{}
 
-	orderBy []string
+	orderBy []orderExpr
+
+	ctes     []cte
+	fromCTE  string
+	compound *compoundSource
+
+	distinct   string
+	distinctOn []string
+
+	fulltext *fulltextSearch
+
+	// knownColumns are the columns of the registered models (see SortFromRequest())
+	knownColumns map[string]bool
+}
+
+type orderExpr struct {
+	expr   string
+	values []interface{}
 }
 
 func (q *Query) IncludeDeleted() *Query {
@@ -79,7 +105,13 @@ func (q *Query) IncludeDeleted() *Query {
 	return q
 }
 
-func (q *Query) RawRows(sql string, values ...interface{}) (*sql.Rows, error) {
+func (q *Query) RawRows(sql string, values ...interface{}) (_ *sql.Rows, err error) {
+	span := startSpan(q.c, q.tracer, q.gormDb, rawOperation(sql), nil, sql)
+	defer func() { endSpan(span, err, -1) }()
+	return q.rawRows(sql, values...)
+}
+
+func (q *Query) rawRows(sql string, values ...interface{}) (*sql.Rows, error) {
 	rows, err := q.gormDb.Raw(sql, values...).Rows()
 	if err != nil {
 		return nil, merry.Wrap(err).Appendf("sql: %v, values= %#v", sql, values)
@@ -103,8 +135,28 @@ func (q *Query) FilterRawExpression(expression string, values ...interface{}) *Q
 	return q
 }
 
+var filterOperators = map[string]bool{
+	"=": true, "<>": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+	"like": true, "ilike": true, "not like": true, "not ilike": true,
+}
+
+// Filter compares the column with the value, the operation must be a comparison (`=`, `<>`, `<`, `ilike`...). Use
+// FilterRawExpression() for anything else.
 func (q *Query) Filter(column, operation string, value interface{}) *Query {
-	q.appendFilterExpressionAndValues("filter", column+operation+"?", value)
+	op := strings.ToLower(strings.TrimSpace(operation))
+	if !filterOperators[op] {
+		q.err = firstErr(q.err, merry.New("invalid filter operator").Appendf("operator: %s", operation))
+		return q
+	}
+	q.appendFilterExpressionAndValues("filter", q.column(column)+" "+op+" ?", value)
+	return q
+}
+
+// Where adds typed predicates (see TypedColumn and the generated <Model>Q variables).
+func (q *Query) Where(preds ...Predicate) *Query {
+	for _, p := range preds {
+		q.appendFilterExpressionAndValues("filter", p.expr, p.values...)
+	}
 	return q
 }
 
@@ -117,7 +169,7 @@ func (q *Query) FilterInStrings(column string, valuesStrs ...string) *Query {
 }
 
 func (q *Query) FilterIsNotNull(column string) *Query {
-	q.appendFilterExpressionAndValues("not_null", column+" is not null")
+	q.appendFilterExpressionAndValues("not_null", q.column(column)+" is not null")
 	return q
 }
 
@@ -131,7 +183,10 @@ func (q *Query) FilterIn(column string, values ...interface{}) *Query {
 		}
 	}
 
-	q.appendFilterExpressionAndValues("filter-in", fmt.Sprint(column, " in (", strings.Trim(strings.Repeat("?,", len(uniqValues)), ","), ")"), uniqValues...)
+	if len(uniqValues) > filterInArrayThreshold {
+		return q.filterInArray(column, uniqValues)
+	}
+	q.appendFilterExpressionAndValues("filter-in", fmt.Sprint(q.column(column), " in (", strings.Trim(strings.Repeat("?,", len(uniqValues)), ","), ")"), uniqValues...)
 	return q
 }
 
@@ -157,7 +212,8 @@ func (q *Query) FilterExpr(expr ...interface{}) *Query {
 	return q.FilterRawExpression(query, params...)
 }
 
-// FulltextSearch uses postgresql fulltext, which means the words must be whole (i.e. it won't search by substrings)
+// FulltextSearch uses postgresql fulltext, which means the words must be whole (i.e. it won't search by substrings).
+// See RankedFulltextSearch() for configs, ranking and prefix matching. The columns are validated and quoted.
 func (q *Query) FulltextSearch(columns []string, values []string) *Query {
 	var expr []interface{}
 	expr = append(expr, "to_tsvector(concat(")
@@ -165,19 +221,15 @@ func (q *Query) FulltextSearch(columns []string, values []string) *Query {
 		if n > 0 {
 			expr = append(expr, ", ' ', ")
 		}
-		expr = append(expr, col)
+		expr = append(expr, q.column(col))
 	}
 	expr = append(expr, ")) @@ ")
 	expr = append(expr, "to_tsquery(")
 
+	// only words, tsquery operators in user input are syntax errors
 	var cleanedValues []string
 	for _, val := range values {
-		for _, val2 := range strings.Split(val, "&") {
-			val2 = strings.TrimSpace(val2)
-			if val2 != "" {
-				cleanedValues = append(cleanedValues, val2)
-			}
-		}
+		cleanedValues = append(cleanedValues, fulltextWords(val)...)
 	}
 
 	expr = append(expr, ExprValue(strings.Join(cleanedValues, " & ")))
@@ -185,8 +237,13 @@ func (q *Query) FulltextSearch(columns []string, values []string) *Query {
 	return q.FilterExpr(expr...)
 }
 
-// FulltextSubsttringSearch can be slow!
+// FulltextSubsttringSearch can be slow! It ignores the query's filters, ordering and paging.
+//
+// Deprecated: use SubstringSearch() (with AddTrigramIndex()).
 func (q *Query) FulltextSubsttringSearch(table string, columns []string, values []string, limit int) (*QueryIterator, error) {
+	if err := validateIdentifiers(append([]string{table}, columns...)...); err != nil {
+		return nil, err
+	}
 	query := ""
 	var params []interface{}
 
@@ -203,7 +260,7 @@ func (q *Query) FulltextSubsttringSearch(table string, columns []string, values
 			query += " and "
 		}
 		query += "search_string ilike '%'||?||'%' "
-		params = append(params, val)
+		params = append(params, likeEscaper.Replace(val))
 	}
 	query += " limit " + fmt.Sprint(limit)
 	return q.RawIterator(query, params...)
@@ -253,8 +310,7 @@ func (q *Query) OrderByRawExpression(expression string, values ...interface{}) *
 	if strings.Count(expression, "?") != len(values) {
 		q.err = merry.New("invalid expression placeholders count").Appendf("'%s' params: %#v", expression, values)
 	}
-	q.orderBy = append(q.orderBy, expression)
-	q.values = append(q.values, values...)
+	q.orderBy = append(q.orderBy, orderExpr{expr: expression, values: values})
 	q.logStr = append(q.logStr, fmt.Sprint("order_by:", expression))
 	return q
 }
@@ -265,12 +321,45 @@ func (q *Query) OrderByExpression(expr ...interface{}) *Query {
 	return q
 }
 
+// OrderByAsc orders by the (validated and quoted) column, use OrderByRawExpression() for expressions.
 func (q *Query) OrderByAsc(column string) *Query {
-	return q.OrderByRawExpression(column + " asc")
+	return q.OrderByRawExpression(q.column(column) + " asc")
 }
 
 func (q *Query) OrderByDesc(column string) *Query {
-	return q.OrderByRawExpression(column + " desc")
+	return q.OrderByRawExpression(q.column(column) + " desc")
+}
+
+// SortFromRequest orders by a (comma separated) sort request parameter like `-created_at,name` (`-` is descending).
+// Only the allowed columns (or aliases, like a fulltext rank) can be used, or all columns of the registered models if
+// none are given. Invalid parameters are query errors with the HTTP code 400.
+func (q *Query) SortFromRequest(param string, allowed ...string) *Query {
+	if len(allowed) == 0 && len(q.knownColumns) == 0 {
+		q.err = firstErr(q.err, merry.New("no allowed sort columns"))
+		return q
+	}
+	for _, part := range strings.Split(param, ",") {
+		column := strings.TrimSpace(part)
+		desc := strings.HasPrefix(column, "-")
+		column = strings.TrimSpace(strings.TrimLeft(column, "+-"))
+		if column == "" {
+			continue
+		}
+		valid := q.knownColumns[strings.ToLower(column)]
+		if len(allowed) > 0 {
+			valid = containsStringFold(allowed, column)
+		}
+		if !valid {
+			q.err = firstErr(q.err, merry.New("invalid sort column").Appendf("column: %s", column).WithHTTPCode(http.StatusBadRequest))
+			return q
+		}
+		if desc {
+			q.OrderByDesc(column)
+		} else {
+			q.OrderByAsc(column)
+		}
+	}
+	return q
 }
 
 func (q *Query) whereExpressionAndValues() []interface{} {
@@ -292,7 +381,23 @@ func (q *Query) getLogStr() string {
 	return strings.Join(q.logStr, " ")
 }
 
-func (q *Query) Count(sample Model) (int, error) {
+// startSpan starts the span with the sql rendered for the execution mode as the statement (without the statement if it
+// can't be rendered).
+func (q *Query) startSpan(operation string, mode QueryMode, model interface{}) Span {
+	var statement string
+	if q.tracer != nil {
+		statement, _, _ = q.buildSQL(mode, model)
+	}
+	return startSpan(q.c, q.tracer, q.gormDb, operation, model, statement)
+}
+
+func (q *Query) addStats(started time.Time, err error, rows int64) {
+	descr := q.getLogStr()
+	recordQuery(q.c, descr)
+	recordStats(q.statsCollector, q.c, started, err, rows, "%s", descr)
+}
+
+func (q *Query) Count(sample Model) (count int, err error) {
 	if q.err != nil {
 		return 0, q.err
 	}
@@ -301,17 +406,33 @@ func (q *Query) Count(sample Model) (int, error) {
 
 	where := q.whereExpressionAndValues()
 	started := time.Now()
-	defer q.statsCollector.AddStats(q.c, started, q.getLogStr())
-
-	var count int
+	var rows int64 = -1
+	span := q.startSpan("SELECT", QueryModeCount, sample)
+	defer func() {
+		q.addStats(started, err, rows)
+		endSpan(span, err, rows)
+	}()
+
+	if q.needsRawDb() {
+		db, err := q.rawDb(QueryModeCount, sample)
+		if err != nil {
+			return 0, err
+		}
+		if err := db.Row().Scan(&count); err != nil {
+			return 0, merry.Wrap(err).Appendf("counting %T", sample)
+		}
+		rows = 1
+		return count, nil
+	}
 	if err := q.prepareDb().Model(sample).Where(where[0], where[1:]...).Count(&count).Error; err != nil {
 		return 0, merry.Wrap(err).Appendf("counting %T", sample)
 	}
 
+	rows = 1
 	return count, nil
 }
 
-func (q *Query) First(target Model) error {
+func (q *Query) First(target Model) (err error) {
 	if q.err != nil {
 		return q.err
 	}
@@ -320,18 +441,34 @@ func (q *Query) First(target Model) error {
 
 	where := q.whereExpressionAndValues()
 	started := time.Now()
-	defer q.statsCollector.AddStats(q.c, started, q.getLogStr())
+	var rows int64 = -1
+	span := q.startSpan("SELECT", QueryModeFirst, target)
+	defer func() {
+		q.addStats(started, err, rows)
+		endSpan(span, err, rows)
+	}()
 
-	if err := q.prepareDb().First(target, where...).Error; err != nil {
+	db := q.prepareDb()
+	if q.needsRawDb() {
+		if db, err = q.rawDb(QueryModeFirst, target); err != nil {
+			return err
+		}
+		db = db.Scan(target)
+	} else {
+		db = db.First(target, where...)
+	}
+	if err := db.Error; err != nil {
 		code := http.StatusInternalServerError
 		if IsRecordNotFound(err) {
 			code = http.StatusNotFound
 		}
 		return merry.Wrap(err).Appendf("error getting first %T", target).WithHTTPCode(code)
 	}
+	rows = 1
 	return nil
 }
 
+// AllWithPageFull is All() which reports if the page is full, see Page() for page metadata with totals.
 func (q *Query) AllWithPageFull(target interface{}) (pageFull bool, err error) {
 	if q.pageSize == 0 {
 		q.pageSize = defaultPageSize
@@ -357,63 +494,109 @@ func (q *Query) allDb(model Model, target interface{}) (*gorm.DB, error) {
 		q.logStr = append(q.logStr, fmt.Sprintf("%T", target))
 	}
 
-	started := time.Now()
-	defer q.statsCollector.AddStats(q.c, started, q.getLogStr())
-
-	if q.pageSize == 0 {
-		q.pageSize = defaultPageSize
-	}
-	db := q.prepareDb()
-	if q.pageNo > 0 {
-		db = db.Offset(q.pageNo * q.pageSize)
+	if q.needsRawDb() {
+		return q.allRawDb(model, target)
 	}
 
+	db := q.pagedDb()
 	if model == nil && target != nil {
 		if reflect.TypeOf(target).Kind() != reflect.Ptr {
 			return nil, merry.New("must be pointer").Appendf("found %T", target)
 		}
-		return db.Limit(q.pageSize).Find(target, where...), nil
+		return db.Find(target, where...), nil
+	} else if model != nil && target == nil {
+		return db.Model(model).Where(where[0], where[1:]...), nil
+	}
+	return nil, merry.New("invalid model and target").Appendf("Model %T, target: %T", model, target)
+}
+
+// allRawDb is allDb for queries gorm can't build (see needsRawDb())
+func (q *Query) allRawDb(model Model, target interface{}) (*gorm.DB, error) {
+	if model == nil && target != nil {
+		db, err := q.rawDb(QueryModeAll, target)
+		if err != nil {
+			return nil, err
+		}
+		return db.Scan(target), nil
 	} else if model != nil && target == nil {
-		return db.Limit(q.pageSize).Model(model).Where(where[0], where[1:]...), nil
+		return q.rawDb(QueryModeAll, model)
 	}
 	return nil, merry.New("invalid model and target").Appendf("Model %T, target: %T", model, target)
 }
 
-func (q *Query) AllIterator(m Model) (*QueryIterator, error) {
+func (q *Query) AllIterator(m Model) (_ *QueryIterator, err error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	started := time.Now()
+	defer func() { q.addStats(started, err, -1) }()
+
 	db, err := q.allDb(m, nil)
 	if err != nil {
 		return nil, err
 	}
+	span := q.startSpan("SELECT", QueryModeIterator, m)
 	rows, err := db.Rows()
 	if err != nil {
+		span.End(err)
 		return nil, err
 	}
-	return &QueryIterator{rows: rows, db: db}, nil
+	return &QueryIterator{rows: rows, db: db, span: newIteratorSpan(span)}, nil
 }
 
 func (q *Query) RawIterator(sql string, values ...interface{}) (*QueryIterator, error) {
-	rows, err := q.RawRows(sql, values...)
+	span := startSpan(q.c, q.tracer, q.gormDb, rawOperation(sql), nil, sql)
+	rows, err := q.rawRows(sql, values...)
 	if err != nil {
+		span.End(err)
 		return nil, err
 	}
-	return &QueryIterator{rows: rows, db: q.gormDb}, nil
+	return &QueryIterator{rows: rows, db: q.gormDb, span: newIteratorSpan(span)}, nil
 }
 
-func (q *Query) All(target interface{}) error {
+func (q *Query) All(target interface{}) (err error) {
+	if q.err != nil {
+		return q.err
+	}
+	started := time.Now()
+	var rows int64 = -1
+	span := q.startSpan("SELECT", QueryModeAll, target)
+	defer func() {
+		q.addStats(started, err, rows)
+		endSpan(span, err, rows)
+	}()
+
 	db, err := q.allDb(nil, target)
 	if err != nil {
 		return err
 	}
+	rows = db.RowsAffected
 	if err := db.Error; err != nil && err != sql.ErrNoRows {
 		return merry.Wrap(err).Appendf("getting %T", target)
 	}
 	return nil
 }
 
+// pagedDb is prepareDb() with offset and limit
+func (q *Query) pagedDb() *gorm.DB {
+	if q.pageSize == 0 {
+		q.pageSize = defaultPageSize
+	}
+	db := q.prepareDb()
+	if q.pageNo > 0 {
+		db = db.Offset(q.pageNo * q.pageSize)
+	}
+	return db.Limit(q.pageSize + q.lookahead)
+}
+
 func (q *Query) prepareDb() *gorm.DB {
 	db := q.gormDb.New()
 	for _, ord := range q.orderBy {
-		db = db.Order(ord)
+		if len(ord.values) == 0 {
+			db = db.Order(ord.expr)
+		} else {
+			db = db.Order(gorm.Expr(ord.expr, ord.values...))
+		}
 	}
 	if q.includeDeleted {
 		db = db.Unscoped()
@@ -0,0 +1,299 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ansel1/merry"
+	utils "github.com/coachbit/gorm-dao/dao/daoutils"
+	"github.com/jinzhu/gorm"
+)
+
+// QueryMode is the query execution method the sql is rendered for (see ToSQLFor()).
+type QueryMode int
+
+const (
+	QueryModeAll QueryMode = iota
+	QueryModeFirst
+	QueryModeCount
+	// QueryModeIterator is AllIterator(), the sql is the same as in All()
+	QueryModeIterator
+)
+
+// queryModeSubquery renders the query for FilterInSubquery() and FilterExists(), paged only if the page is explicitly
+// set
+const queryModeSubquery QueryMode = -1
+
+// NewOfflineQuery creates a query without a database connection, it can be used only to render sql (see ToSQL()), all
+// executions fail with ErrOffline.
+func NewOfflineQuery(c context.Context, dialect string) (*Query, error) {
+	db, err := offlineGormDb(dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &Query{c: c, gormDb: db}, nil
+}
+
+// ToSQL renders the sql (with the dialect's placeholders) and values All() would execute, without executing it.
+func (q *Query) ToSQL(sample Model) (string, []interface{}, error) {
+	return q.ToSQLFor(QueryModeAll, sample)
+}
+
+// ToSQLFor is ToSQL() for the given execution method.
+func (q *Query) ToSQLFor(mode QueryMode, sample Model) (string, []interface{}, error) {
+	return q.buildSQL(mode, sample)
+}
+
+// sqlDb prepares (but doesn't execute) the gorm query like All(), First() and Count() do. The returned values are
+// the values of the source (see sourceDb()).
+func (q *Query) sqlDb(mode QueryMode, sample interface{}) (*gorm.DB, []interface{}, error) {
+	if q.err != nil {
+		return nil, nil, q.err
+	}
+	if err := q.validateDistinctOn(); err != nil {
+		return nil, nil, err
+	}
+	where := q.whereExpressionAndValues()
+	var db *gorm.DB
+	switch mode {
+	case QueryModeFirst:
+		db = q.prepareDb().Model(sample).Where(where[0], where[1:]...)
+		scope := q.gormDb.NewScope(sample)
+		if pk := scope.PrimaryField(); pk != nil {
+			// gorm appends the primary key ordering in First()
+			db = db.Order(fmt.Sprintf("%v.%v ASC", scope.QuotedTableName(), scope.Quote(pk.DBName)))
+		}
+		db = db.Limit(1)
+	case QueryModeCount:
+		// gorm ignores the ordering in Count()
+		db = q.gormDb.New()
+		if q.includeDeleted {
+			db = db.Unscoped()
+		}
+		db = db.Model(sample).Where(where[0], where[1:]...)
+		if q.distinct != "" {
+			return q.distinctCountDb(db, sample)
+		}
+		db = db.Select("count(*)")
+	case queryModeSubquery:
+		db = q.prepareDb()
+		if q.pageSize > 0 && q.pageNo > 0 {
+			db = db.Offset(q.pageNo * q.pageSize)
+		}
+		if q.pageSize > 0 {
+			db = db.Limit(q.pageSize)
+		}
+		db = db.Model(sample).Where(where[0], where[1:]...)
+	default:
+		db = q.pagedDb().Model(sample).Where(where[0], where[1:]...)
+	}
+	if q.distinct != "" {
+		db = db.Select(q.selectExpr("*"))
+	}
+	return q.sourceDb(db, sample)
+}
+
+// sourceDb replaces the model's table with the set operation (see Union()) or the CTE (see FromCTE()). The source is
+// aliased with the table name, and the values of the source sql are returned.
+func (q *Query) sourceDb(db *gorm.DB, sample interface{}) (*gorm.DB, []interface{}, error) {
+	if q.compound == nil {
+		db, err := q.fromCTEDb(db, sample)
+		return db, nil, err
+	}
+	if q.fromCTE != "" {
+		return nil, nil, merry.New("FromCTE can't be used with set operations")
+	}
+	sql, values, err := q.compound.render(sample)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db.Unscoped().Table(sql + " AS " + q.gormDb.NewScope(sample).QuotedTableName()), values, nil
+}
+
+// needsRawDb is true if gorm can't build the query, and it must be executed with rawDb().
+func (q *Query) needsRawDb() bool {
+	return len(q.ctes) > 0 || q.compound != nil || q.distinct != ""
+}
+
+// renderSQL renders the prepared query (with the CTEs) with `?` placeholders, so that it can be executed with Raw() or
+// embedded in other queries.
+func (q *Query) renderSQL(db *gorm.DB, sourceValues []interface{}) (string, []interface{}, error) {
+	sql, values, err := q.renderSelect(db, sourceValues)
+	if err != nil || len(q.ctes) == 0 {
+		return sql, values, err
+	}
+	with, withValues := q.withClause()
+	return with + sql, append(withValues, values...), nil
+}
+
+// renderSelect is renderSQL without the CTEs.
+func (q *Query) renderSelect(db *gorm.DB, sourceValues []interface{}) (string, []interface{}, error) {
+	if err := db.Error; err != nil {
+		return "", nil, merry.Wrap(err)
+	}
+	scope := q.gormDb.NewScope(nil)
+	scope.InstanceSet("skip_bindvar", true)
+	sql := scope.AddToVars(db.QueryExpr())
+	// the source is in the FROM clause, before all other placeholders
+	return sql, append(append([]interface{}{}, sourceValues...), scope.SQLVars...), nil
+}
+
+// buildSQL renders the sql (with dialect placeholders) and its values.
+func (q *Query) buildSQL(mode QueryMode, sample interface{}) (string, []interface{}, error) {
+	sql, values, err := q.renderQuery(mode, sample)
+	if err != nil {
+		return "", nil, err
+	}
+	sql, values = q.numberPlaceholders(sample, sql, values)
+	return sql, values, nil
+}
+
+// numberPlaceholders replaces the `?` placeholders of rendered sql with the dialect's (`$n` for postgres).
+func (q *Query) numberPlaceholders(sample interface{}, sql string, values []interface{}) (string, []interface{}) {
+	scope := q.gormDb.NewScope(sample)
+	return scope.AddToVars(gorm.Expr(sql, values...)), scope.SQLVars
+}
+
+// renderQuery is buildSQL with `?` placeholders.
+func (q *Query) renderQuery(mode QueryMode, sample interface{}) (string, []interface{}, error) {
+	db, sourceValues, err := q.sqlDb(mode, sample)
+	if err != nil {
+		return "", nil, err
+	}
+	return q.renderSQL(db, sourceValues)
+}
+
+// rawDb is the query as raw gorm db, used for executing queries which gorm can't build (see needsRawDb()).
+func (q *Query) rawDb(mode QueryMode, sample interface{}) (*gorm.DB, error) {
+	sql, values, err := q.renderQuery(mode, sample)
+	if err != nil {
+		return nil, err
+	}
+	return q.gormDb.New().Raw(sql, values...), nil
+}
+
+// PlanNode is one node of the (postgres) json query plan.
+type PlanNode struct {
+	NodeType     string     `json:"Node Type"`
+	RelationName string     `json:"Relation Name,omitempty"`
+	IndexName    string     `json:"Index Name,omitempty"`
+	StartupCost  float64    `json:"Startup Cost"`
+	TotalCost    float64    `json:"Total Cost"`
+	PlanRows     float64    `json:"Plan Rows"`
+	ActualRows   *float64   `json:"Actual Rows,omitempty"`
+	ActualLoops  *float64   `json:"Actual Loops,omitempty"`
+	Plans        []PlanNode `json:"Plans,omitempty"`
+}
+
+func (n PlanNode) walk(f func(n PlanNode)) {
+	f(n)
+	for _, child := range n.Plans {
+		child.walk(f)
+	}
+}
+
+type QueryPlan struct {
+	SQL    string
+	Values []interface{}
+	// Analyzed is true for ExplainAnalyze(), only then the actual rows and the execution time are known
+	Analyzed bool
+
+	Root PlanNode
+	// TotalCost is the estimated cost of the whole query (in postgres cost units)
+	TotalCost     float64
+	EstimatedRows float64
+	// ActualRows is -1 if not analyzed
+	ActualRows      float64
+	PlanningTimeMs  float64
+	ExecutionTimeMs float64
+	// SeqScanTables are all tables read with sequential scans
+	SeqScanTables []string
+	// LargeSeqScan is true if a sequential scan is done on a table with (estimated) many rows
+	LargeSeqScan bool
+
+	Raw json.RawMessage
+}
+
+type explainOutput struct {
+	Plan          PlanNode `json:"Plan"`
+	PlanningTime  float64  `json:"Planning Time"`
+	ExecutionTime float64  `json:"Execution Time"`
+}
+
+// Explain returns the plan of the query All() would execute (filters, ordering, paging and deleted rows).
+func (q *Query) Explain(sample Model) (*QueryPlan, error) {
+	return q.explain(QueryModeAll, sample, false)
+}
+
+// ExplainAnalyze is like Explain() but the query is executed, so the plan contains actual row counts and times.
+func (q *Query) ExplainAnalyze(sample Model) (*QueryPlan, error) {
+	return q.explain(QueryModeAll, sample, true)
+}
+
+func (q *Query) explain(mode QueryMode, sample Model, analyze bool) (*QueryPlan, error) {
+	// the sql with `?` placeholders is bound once by Raw(), binding `$n` sql again would take any `?` left in it (a
+	// jsonb operator or a literal) as a placeholder
+	rawSQL, rawValues, err := q.renderQuery(mode, sample)
+	if err != nil {
+		return nil, err
+	}
+	sql, values := q.numberPlaceholders(sample, rawSQL, rawValues)
+	explain := "EXPLAIN (FORMAT JSON) "
+	if analyze {
+		explain = "EXPLAIN (ANALYZE, FORMAT JSON) "
+	}
+
+	var raw []byte
+	if err := q.gormDb.New().Raw(explain+rawSQL, rawValues...).Row().Scan(&raw); err != nil {
+		return nil, merry.Wrap(err).Appendf("explaining %s", sql)
+	}
+	var outputs []explainOutput
+	if err := json.Unmarshal(raw, &outputs); err != nil || len(outputs) == 0 {
+		return nil, merry.New("invalid explain output").Appendf("%s", string(raw))
+	}
+
+	out := outputs[0]
+	plan := &QueryPlan{
+		SQL:             sql,
+		Values:          values,
+		Analyzed:        analyze,
+		Root:            out.Plan,
+		TotalCost:       out.Plan.TotalCost,
+		EstimatedRows:   out.Plan.PlanRows,
+		ActualRows:      -1,
+		PlanningTimeMs:  out.PlanningTime,
+		ExecutionTimeMs: out.ExecutionTime,
+		Raw:             raw,
+	}
+	if out.Plan.ActualRows != nil {
+		plan.ActualRows = *out.Plan.ActualRows
+	}
+	out.Plan.walk(func(n PlanNode) {
+		if n.NodeType == "Seq Scan" && n.RelationName != "" && !containsString(plan.SeqScanTables, n.RelationName) {
+			plan.SeqScanTables = append(plan.SeqScanTables, n.RelationName)
+		}
+	})
+	if len(plan.SeqScanTables) > 0 {
+		if plan.LargeSeqScan, err = q.largeTables(plan.SeqScanTables); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// largeTables checks if any of the tables has more (estimated) rows than seqScanHeavyMinRows
+func (q *Query) largeTables(tables []string) (bool, error) {
+	rows, err := q.rawRows(`select coalesce(max(reltuples), 0)::bigint from pg_class where relkind in ('r', 'p') and relname in (?)`, tables)
+	if err != nil {
+		return false, err
+	}
+	defer utils.CloseCloser(rows)
+	var maxRows int64
+	for rows.Next() {
+		if err := rows.Scan(&maxRows); err != nil {
+			return false, merry.Wrap(err)
+		}
+	}
+	return maxRows >= seqScanHeavyMinRows, merry.Wrap(rows.Err())
+}
@@ -0,0 +1,46 @@
+package dao
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/coachbit/gorm-dao/dao/stats"
+)
+
+type addStatsCollector struct{ calls int }
+
+func (a *addStatsCollector) AddStats(context.Context, time.Time, string, ...interface{}) { a.calls++ }
+
+type outcomeCollector struct {
+	addStatsCollector
+	results []stats.Result
+}
+
+func (o *outcomeCollector) Record(_ context.Context, _ time.Time, res stats.Result, _ string, _ ...interface{}) {
+	o.results = append(o.results, res)
+}
+
+func TestRecordStats(t *testing.T) {
+	t.Parallel()
+
+	c := context.Background()
+	recordStats(nil, c, time.Now(), nil, 1, "x")
+	var typedNil *addStatsCollector
+	recordStats(typedNil, c, time.Now(), nil, 1, "x")
+
+	plain := &addStatsCollector{}
+	recordStats(plain, c, time.Now(), merry.New("x"), 1, "x")
+	if plain.calls != 1 {
+		t.Errorf("expected AddStats, got %d calls", plain.calls)
+	}
+
+	outcomes := &outcomeCollector{}
+	recordStats(outcomes, c, time.Now(), nil, 3, "x")
+	recordStats(outcomes, c, time.Now(), merry.New("x"), 3, "x")
+	expected := []stats.Result{{Outcome: stats.OutcomeOK, Rows: 3}, {Outcome: stats.OutcomeError, Rows: -1}}
+	if outcomes.calls != 0 || len(outcomes.results) != 2 || outcomes.results[0] != expected[0] || outcomes.results[1] != expected[1] {
+		t.Errorf("expected %+v, got %+v (%d AddStats calls)", expected, outcomes.results, outcomes.calls)
+	}
+}
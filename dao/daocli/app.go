@@ -0,0 +1,410 @@
+// Package daocli implements the `gormdao` command line tool.
+//
+// The generic binary (cmd/gormdao) doesn't know your models, so commands which need them (`schema diff`, `generate`,
+// model migrations in `migrate up`) are available only in your own binary:
+//
+//	func main() {
+//		daocli.Main(daocli.App{
+//			Models: []interface{}{&models.User{}, &models.Org{}},
+//			AfterInit: func(c context.Context, d *dao.Dao) error {
+//				return d.AddUniqueIndex(c, "uix_users_email", "Email already used", &models.User{}, "email")
+//			},
+//		})
+//	}
+package daocli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/coachbit/gorm-dao/dao"
+	utils "github.com/coachbit/gorm-dao/dao/daoutils"
+	"github.com/coachbit/gorm-dao/dao/stats"
+)
+
+const usage = `Usage: gormdao [-config gormdao.json] [-debug] <command>
+
+Commands:
+  migrate up                    apply sql migrations and migrate models
+  migrate down [-steps n]       revert the last n sql migrations (default 1)
+  migrate status                list sql migrations
+  schema diff [-sql]            compare models with the database
+  generate columns -out f [-md f] [-package p]
+  generate docs -out f [-introspect]
+  dbinfo [-json] [-schemas s]   table sizes, vacuum info, unused indexes
+  stats                         table usage statistics
+  seed [-file f.sql] [name...]  execute seeders (all if no names given) or a sql file
+`
+
+type Seeder func(c context.Context, d *dao.Dao) error
+
+type App struct {
+	Models  []interface{}
+	Seeders map[string]Seeder
+	// Setup is called before Dao.Init(), for example to add initial statements
+	Setup func(d *dao.Dao)
+	// AfterInit is called after Dao.Init(), register indexes here (they are not created, except in `migrate up`)
+	AfterInit func(c context.Context, d *dao.Dao) error
+
+	Out io.Writer
+	Err io.Writer
+
+	config Config
+}
+
+// Main runs the app with os.Args and exits on errors.
+func Main(app App) {
+	if err := app.Run(context.Background(), os.Args[1:]); err != nil {
+		fmt.Fprintln(app.errWriter(), "Error:", err.Error())
+		if details := merry.Details(err); details != "" && app.config.Debug {
+			fmt.Fprintln(app.errWriter(), details)
+		}
+		os.Exit(1)
+	}
+}
+
+func (a *App) out() io.Writer {
+	if a.Out == nil {
+		return os.Stdout
+	}
+	return a.Out
+}
+
+func (a *App) errWriter() io.Writer {
+	if a.Err == nil {
+		return os.Stderr
+	}
+	return a.Err
+}
+
+func (a *App) printf(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(a.out(), format, args...)
+}
+
+func (a *App) Run(c context.Context, args []string) error {
+	flags := flag.NewFlagSet("gormdao", flag.ContinueOnError)
+	flags.SetOutput(a.errWriter())
+	flags.Usage = func() { _, _ = fmt.Fprint(a.errWriter(), usage) }
+	configFile := flags.String("config", DefaultConfigFile, "config file")
+	debug := flags.Bool("debug", false, "debug logging")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	configSet := false
+	flags.Visit(func(f *flag.Flag) { configSet = configSet || f.Name == "config" })
+	cfg, err := LoadConfig(*configFile, configSet)
+	if err != nil {
+		return err
+	}
+	cfg.Debug = cfg.Debug || *debug
+	a.config = cfg
+
+	args = flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		return merry.New("no command")
+	}
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "migrate":
+		return a.migrate(c, args)
+	case "schema":
+		return a.schema(c, args)
+	case "generate":
+		return a.generate(c, args)
+	case "dbinfo":
+		return a.dbInfo(c, args)
+	case "stats":
+		return a.stats(c, args)
+	case "seed":
+		return a.seed(c, args)
+	}
+	flags.Usage()
+	return merry.New("unknown command").Appendf("command %s", cmd)
+}
+
+// newDao creates the Dao, if connect is set it's also initialized (but models are never migrated implicitly).
+func (a *App) newDao(c context.Context, connect bool) (*dao.Dao, error) {
+	d := dao.New(a.config.Version, a.config.Driver, a.config.DSN, a.Models...)
+	d.Debug = a.config.Debug
+	d.SkipMigrations = true
+	d.Logger = &writerLogger{w: a.errWriter(), debug: a.config.Debug}
+	d.StatsCollector = stats.NewStatsCollector("gormdao", 24*time.Hour, 20)
+	if a.Setup != nil {
+		a.Setup(d)
+	}
+	if !connect {
+		return d, nil
+	}
+	if a.config.DSN == "" {
+		return nil, merry.New("no dsn configured").Appendf("set it in %s or GORMDAO_DSN", DefaultConfigFile)
+	}
+	if err := d.Init(); err != nil {
+		return nil, err
+	}
+	if a.AfterInit != nil {
+		if err := a.AfterInit(c, d); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+func (a *App) requireModels() error {
+	if len(a.Models) == 0 {
+		return merry.New("no models registered").Append("build your own binary with daocli.App{Models: ...}")
+	}
+	return nil
+}
+
+func subcommand(args []string, name string) (string, []string, error) {
+	if len(args) == 0 {
+		return "", nil, merry.New("missing subcommand").Appendf("for %s", name)
+	}
+	return args[0], args[1:], nil
+}
+
+func (a *App) migrate(c context.Context, args []string) error {
+	sub, args, err := subcommand(args, "migrate")
+	if err != nil {
+		return err
+	}
+	flags := flag.NewFlagSet("migrate "+sub, flag.ContinueOnError)
+	steps := flags.Int("steps", 1, "number of migrations to revert")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	d, err := a.newDao(c, true)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = d.Clean() }()
+	migrator := NewMigrator(d, a.config.MigrationsDir)
+
+	switch sub {
+	case "up":
+		if _, statErr := os.Stat(a.config.MigrationsDir); statErr == nil {
+			applied, err := migrator.Up(c)
+			for _, version := range applied {
+				a.printf("applied %s\n", version)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if len(a.Models) > 0 {
+			if err := d.AutoMigrate(c); err != nil {
+				return err
+			}
+			a.printf("migrated %d models\n", len(a.Models))
+		}
+		return nil
+	case "down":
+		reverted, err := migrator.Down(c, *steps)
+		for _, version := range reverted {
+			a.printf("reverted %s\n", version)
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status(c)
+		if err != nil {
+			return err
+		}
+		for _, st := range statuses {
+			if st.Applied {
+				a.printf("%-50s applied %s\n", st.Version, st.AppliedAt.Format(time.RFC3339))
+			} else {
+				a.printf("%-50s pending\n", st.Version)
+			}
+		}
+		return nil
+	}
+	return merry.New("unknown subcommand").Appendf("migrate %s", sub)
+}
+
+func (a *App) schema(c context.Context, args []string) error {
+	sub, args, err := subcommand(args, "schema")
+	if err != nil {
+		return err
+	}
+	if sub != "diff" {
+		return merry.New("unknown subcommand").Appendf("schema %s", sub)
+	}
+	flags := flag.NewFlagSet("schema diff", flag.ContinueOnError)
+	withSQL := flags.Bool("sql", false, "print sql to reconcile the database")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := a.requireModels(); err != nil {
+		return err
+	}
+
+	d, err := a.newDao(c, true)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = d.Clean() }()
+
+	diff, err := d.SchemaDiffIn(c, a.config.Schema)
+	if err != nil {
+		return err
+	}
+	a.printf("%s", diff.String())
+	if *withSQL {
+		a.printf("\n%s\n", strings.Join(diff.SQL(), "\n"))
+	}
+	return nil
+}
+
+func (a *App) generate(c context.Context, args []string) error {
+	sub, args, err := subcommand(args, "generate")
+	if err != nil {
+		return err
+	}
+	flags := flag.NewFlagSet("generate "+sub, flag.ContinueOnError)
+	out := flags.String("out", "", "target file")
+	md := flags.String("md", "", "markdown file (columns only)")
+	pkg := flags.String("package", "", "package of the generated file")
+	introspect := flags.Bool("introspect", false, "include the live database schema (docs only)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		return merry.New("-out is required")
+	}
+	if err := a.requireModels(); err != nil {
+		return err
+	}
+
+	switch sub {
+	case "columns":
+		return dao.GenerateColumns(dao.GeneratorOptions{Package: *pkg, TargetFile: *out, TablesMd: *md, Dialect: a.config.Driver}, a.Models...)
+	case "docs":
+		d, err := a.newDao(c, *introspect)
+		if err != nil {
+			return err
+		}
+		if *introspect {
+			defer func() { _ = d.Clean() }()
+		}
+		return d.GenerateSchemaDocs(c, *out, dao.SchemaDocsOptions{Introspect: *introspect, Schema: a.config.Schema})
+	}
+	return merry.New("unknown subcommand").Appendf("generate %s", sub)
+}
+
+func (a *App) dbInfo(c context.Context, args []string) error {
+	flags := flag.NewFlagSet("dbinfo", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "json output")
+	schemas := flags.String("schemas", "", "comma separated schemas (default is the configured schema or public)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	d, err := a.newDao(c, true)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = d.Clean() }()
+
+	var schemaNames []string
+	if names := utils.FirstNonEmpty(*schemas, a.config.Schema); names != "" {
+		schemaNames = strings.Split(names, ",")
+	}
+	report, err := d.DetailedDbInfo(c, schemaNames...)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		byts, err := report.JSON()
+		if err != nil {
+			return err
+		}
+		a.printf("%s\n", byts)
+		return nil
+	}
+	a.printf("%s", report.String())
+	return nil
+}
+
+func (a *App) stats(c context.Context, args []string) error {
+	d, err := a.newDao(c, true)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = d.Clean() }()
+
+	rows, err := d.Query(c).RawRows(`select relname, seq_scan, coalesce(idx_scan, 0), n_tup_ins, n_tup_upd, n_tup_del, n_live_tup, n_dead_tup
+from pg_stat_user_tables
+order by seq_scan + coalesce(idx_scan, 0) desc`)
+	if err != nil {
+		return err
+	}
+	defer utils.CloseCloser(rows)
+
+	a.printf("%-30s %12s %12s %12s %12s %12s %12s %12s\n", "table", "seq scans", "idx scans", "inserted", "updated", "deleted", "live rows", "dead rows")
+	for rows.Next() {
+		var table string
+		var seqScan, idxScan, ins, upd, del, live, dead int64
+		if err := rows.Scan(&table, &seqScan, &idxScan, &ins, &upd, &del, &live, &dead); err != nil {
+			return merry.Wrap(err)
+		}
+		a.printf("%-30s %12d %12d %12d %12d %12d %12d %12d\n", table, seqScan, idxScan, ins, upd, del, live, dead)
+	}
+	return merry.Wrap(rows.Err())
+}
+
+func (a *App) seed(c context.Context, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	file := flags.String("file", "", "sql file to execute")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	names := flags.Args()
+	if *file == "" && len(names) == 0 {
+		for name := range a.Seeders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	if *file == "" && len(names) == 0 {
+		return merry.New("no seeders registered and no -file given")
+	}
+
+	d, err := a.newDao(c, true)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = d.Clean() }()
+
+	if *file != "" {
+		byts, err := os.ReadFile(*file)
+		if err != nil {
+			return merry.Wrap(err).Appendf("reading %s", *file)
+		}
+		if _, err := d.Exec(c, string(byts)); err != nil {
+			return err
+		}
+		a.printf("executed %s\n", *file)
+	}
+	for _, name := range names {
+		seeder, found := a.Seeders[name]
+		if !found {
+			return merry.New("unknown seeder").Appendf("seeder %s", name)
+		}
+		if err := seeder(c, d); err != nil {
+			return merry.Wrap(err).Appendf("seeder %s", name)
+		}
+		a.printf("seeded %s\n", name)
+	}
+	return nil
+}
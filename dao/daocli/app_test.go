@@ -0,0 +1,89 @@
+package daocli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type appModel struct {
+	Name string
+}
+
+func TestRunArguments(t *testing.T) {
+	t.Setenv("GORMDAO_DSN", "")
+
+	for _, tc := range []struct {
+		name   string
+		app    App
+		args   []string
+		err    string
+		output string
+	}{
+		{name: "no command", args: nil, err: "no command", output: "Usage: gormdao"},
+		{name: "unknown command", args: []string{"nope"}, err: "unknown command", output: "Usage: gormdao"},
+		{name: "unknown flag", args: []string{"-nope", "migrate", "up"}, err: "flag provided but not defined"},
+		{name: "missing config", args: []string{"-config", "missing.json", "migrate", "up"}, err: "no such file"},
+		{name: "missing subcommand", args: []string{"migrate"}, err: "missing subcommand"},
+		{name: "invalid steps", args: []string{"migrate", "down", "-steps", "x"}, err: "invalid value"},
+		{name: "no dsn", args: []string{"-debug", "migrate", "status"}, err: "no dsn configured"},
+		{name: "unknown schema subcommand", args: []string{"schema", "nope"}, err: "unknown subcommand"},
+		{name: "schema diff without models", args: []string{"schema", "diff"}, err: "no models registered"},
+		{name: "generate without out", args: []string{"generate", "columns"}, err: "-out is required"},
+		{name: "unknown generate subcommand", app: App{Models: []interface{}{&appModel{}}}, args: []string{"generate", "nope", "-out", "x"}, err: "unknown subcommand"},
+		{name: "seed without seeders", args: []string{"seed"}, err: "no seeders registered"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var out, errOut bytes.Buffer
+			app := tc.app
+			app.Out, app.Err = &out, &errOut
+			err := app.Run(context.Background(), tc.args)
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("expected %q error, got %v", tc.err, err)
+			}
+			if !strings.Contains(errOut.String(), tc.output) {
+				t.Errorf("expected %q in the output, got %q", tc.output, errOut.String())
+			}
+		})
+	}
+}
+
+func TestRunMigrate(t *testing.T) {
+	t.Setenv("GORMDAO_DSN", "")
+
+	_, db := newFakeDao(t)
+	dir := writeMigrations(t, map[string]string{"0001_a.up.sql": "create a", "0002_b.up.sql": "create b"})
+	config := filepath.Join(t.TempDir(), "gormdao.json")
+	byts, _ := json.Marshal(Config{Driver: fakeDriverName, DSN: t.Name(), MigrationsDir: dir})
+	if err := os.WriteFile(config, byts, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"applied 0001_a\napplied 0002_b\n", ""} {
+		var out bytes.Buffer
+		app := App{Out: &out, Err: io.Discard}
+		if err := app.Run(context.Background(), []string{"-config", config, "migrate", "up"}); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != expected {
+			t.Errorf("expected %q, got %q", expected, out.String())
+		}
+	}
+	if len(db.Executed()) != 2 {
+		t.Errorf("expected 2 migrations executed, got %q", db.Executed())
+	}
+
+	var out bytes.Buffer
+	app := App{Out: &out, Err: io.Discard}
+	if err := app.Run(context.Background(), []string{"-config", config, "migrate", "status"}); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 2 || !strings.Contains(lines[0], "0001_a") || !strings.Contains(lines[1], "applied") {
+		t.Errorf("invalid status: %q", out.String())
+	}
+}
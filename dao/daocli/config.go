@@ -0,0 +1,52 @@
+package daocli
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/ansel1/merry"
+)
+
+const (
+	DefaultConfigFile    = "gormdao.json"
+	DefaultMigrationsDir = "migrations"
+)
+
+// Config is loaded from a json file, and can be overridden with GORMDAO_DRIVER, GORMDAO_DSN and GORMDAO_SCHEMA env
+// variables.
+type Config struct {
+	Driver        string `json:"driver"`
+	DSN           string `json:"dsn"`
+	Version       string `json:"version"`
+	Schema        string `json:"schema"`
+	MigrationsDir string `json:"migrations_dir"`
+	Debug         bool   `json:"debug"`
+}
+
+// LoadConfig loads the config file, a missing file is not an error (if it's not explicitly set) because everything can
+// be configured with env variables.
+func LoadConfig(file string, required bool) (Config, error) {
+	cfg := Config{
+		Driver:        "postgres",
+		MigrationsDir: DefaultMigrationsDir,
+	}
+	byts, err := os.ReadFile(file)
+	if err != nil {
+		if required || !os.IsNotExist(err) {
+			return cfg, merry.Wrap(err).Appendf("reading config %s", file)
+		}
+	} else if err := json.Unmarshal(byts, &cfg); err != nil {
+		return cfg, merry.Wrap(err).Appendf("parsing config %s", file)
+	}
+
+	if env := os.Getenv("GORMDAO_DRIVER"); env != "" {
+		cfg.Driver = env
+	}
+	if env := os.Getenv("GORMDAO_DSN"); env != "" {
+		cfg.DSN = env
+	}
+	if env := os.Getenv("GORMDAO_SCHEMA"); env != "" {
+		cfg.Schema = env
+	}
+	return cfg, nil
+}
@@ -0,0 +1,63 @@
+package daocli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/coachbit/gorm-dao/dao"
+)
+
+var _ dao.Logger = new(writerLogger)
+
+type writerLogger struct {
+	w     io.Writer
+	debug bool
+
+	mutex        sync.Mutex
+	errorSamples []string
+}
+
+func (l *writerLogger) log(level, format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(l.w, level+": "+format+"\n", args...)
+}
+
+func (l *writerLogger) Debugf(c context.Context, format string, args ...interface{}) {
+	if l.debug {
+		l.log("DEBUG", format, args...)
+	}
+}
+
+func (l *writerLogger) Infof(c context.Context, format string, args ...interface{}) {
+	if l.debug {
+		l.log("INFO", format, args...)
+	}
+}
+
+func (l *writerLogger) Warningf(c context.Context, format string, args ...interface{}) {
+	l.log("WARNING", format, args...)
+}
+
+func (l *writerLogger) Errorf(c context.Context, format string, args ...interface{}) {
+	l.mutex.Lock()
+	l.errorSamples = append(l.errorSamples, fmt.Sprintf(format, args...))
+	l.mutex.Unlock()
+	l.log("ERROR", format, args...)
+}
+
+func (l *writerLogger) Errf(c context.Context, err error, format string, args ...interface{}) {
+	l.Errorf(c, format+": %s", append(args, err.Error())...)
+}
+
+func (l *writerLogger) Criticalf(c context.Context, format string, args ...interface{}) {
+	l.log("CRITICAL", format, args...)
+}
+
+func (l *writerLogger) ClearErrorSamples() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	res := l.errorSamples
+	l.errorSamples = nil
+	return res
+}
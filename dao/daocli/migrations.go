@@ -0,0 +1,182 @@
+package daocli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/coachbit/gorm-dao/dao"
+	utils "github.com/coachbit/gorm-dao/dao/daoutils"
+)
+
+const migrationsTable = dao.MigrationsTable
+
+// migrationFileRegexp matches files like `0001_create_users.up.sql` and `0001_create_users.down.sql`
+var migrationFileRegexp = regexp.MustCompile(`^(\d+_[\w\-]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	// Version is the file name without the `.up.sql`/`.down.sql` suffix
+	Version  string
+	UpFile   string
+	DownFile string
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// Migrator executes sql migrations from a directory, applied versions are stored in the `schema_migrations` table.
+// Every migration is executed (together with the version update) as a single multi-statement query, i.e. in one
+// implicit transaction.
+type Migrator struct {
+	dao *dao.Dao
+	dir string
+}
+
+func NewMigrator(d *dao.Dao, dir string) *Migrator {
+	return &Migrator{dao: d, dir: dir}
+}
+
+func (m *Migrator) Migrations() ([]Migration, error) {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return nil, merry.Wrap(err).Appendf("reading migrations from %s", m.dir)
+	}
+	byVersion := map[string]*Migration{}
+	for _, entry := range entries {
+		match := migrationFileRegexp.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		mig, found := byVersion[match[1]]
+		if !found {
+			mig = &Migration{Version: match[1]}
+			byVersion[match[1]] = mig
+		}
+		if match[2] == "up" {
+			mig.UpFile = filepath.Join(m.dir, entry.Name())
+		} else {
+			mig.DownFile = filepath.Join(m.dir, entry.Name())
+		}
+	}
+
+	var res []Migration
+	for _, mig := range byVersion {
+		if mig.UpFile == "" {
+			return nil, merry.New("migration without the up file").Appendf("version %s", mig.Version)
+		}
+		res = append(res, *mig)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+	return res, nil
+}
+
+func (m *Migrator) ensureTable(c context.Context) error {
+	_, err := m.dao.Exec(c, `CREATE TABLE IF NOT EXISTS `+migrationsTable+` (version text PRIMARY KEY, applied_at timestamp with time zone NOT NULL DEFAULT now())`)
+	return err
+}
+
+func (m *Migrator) applied(c context.Context) (map[string]time.Time, error) {
+	if err := m.ensureTable(c); err != nil {
+		return nil, err
+	}
+	rows, err := m.dao.Query(c).RawRows(`SELECT version, applied_at FROM ` + migrationsTable)
+	if err != nil {
+		return nil, err
+	}
+	defer utils.CloseCloser(rows)
+
+	res := map[string]time.Time{}
+	for rows.Next() {
+		var version string
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, merry.Wrap(err)
+		}
+		res[version] = appliedAt
+	}
+	return res, merry.Wrap(rows.Err())
+}
+
+func (m *Migrator) Status(c context.Context) ([]MigrationStatus, error) {
+	migrations, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(c)
+	if err != nil {
+		return nil, err
+	}
+	var res []MigrationStatus
+	for _, mig := range migrations {
+		st := MigrationStatus{Migration: mig}
+		if appliedAt, found := applied[mig.Version]; found {
+			st.Applied = true
+			st.AppliedAt = &appliedAt
+		}
+		res = append(res, st)
+	}
+	return res, nil
+}
+
+// Up applies all pending migrations, and returns their versions.
+func (m *Migrator) Up(c context.Context) ([]string, error) {
+	statuses, err := m.Status(c)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, st := range statuses {
+		if st.Applied {
+			continue
+		}
+		if err := m.execute(c, st.UpFile, `INSERT INTO `+migrationsTable+` (version) VALUES ('`+st.Version+`')`); err != nil {
+			return res, err
+		}
+		res = append(res, st.Version)
+	}
+	return res, nil
+}
+
+// Down reverts the last `steps` applied migrations, and returns their versions.
+func (m *Migrator) Down(c context.Context, steps int) ([]string, error) {
+	statuses, err := m.Status(c)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for i := len(statuses) - 1; i >= 0 && len(res) < steps; i-- {
+		st := statuses[i]
+		if !st.Applied {
+			continue
+		}
+		if st.DownFile == "" {
+			return res, merry.New("no down migration").Appendf("version %s", st.Version)
+		}
+		if err := m.execute(c, st.DownFile, `DELETE FROM `+migrationsTable+` WHERE version = '`+st.Version+`'`); err != nil {
+			return res, err
+		}
+		res = append(res, st.Version)
+	}
+	return res, nil
+}
+
+// execute runs the migration file and the version statement in one multi-statement query (the version is safe to
+// inline, it's validated by migrationFileRegexp). The stats, spans and errors show the file name, not its content.
+func (m *Migrator) execute(c context.Context, file, versionStmt string) error {
+	byts, err := os.ReadFile(file)
+	if err != nil {
+		return merry.Wrap(err).Appendf("reading %s", file)
+	}
+	label := "migration:" + filepath.Base(file)
+	if _, err := m.dao.ExecLabeled(c, label, string(byts)+"\n;\n"+versionStmt+";"); err != nil {
+		return merry.Wrap(err).Appendf("migration %s", file)
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package daocli
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coachbit/gorm-dao/dao"
+)
+
+// fakeDriverName is a database/sql driver which only understands the Migrator's statements
+const fakeDriverName = "daocli-fake"
+
+var (
+	fakeInsertRegexp = regexp.MustCompile(`INSERT INTO ` + migrationsTable + ` \(version\) VALUES \('([^']+)'\)`)
+	fakeDeleteRegexp = regexp.MustCompile(`DELETE FROM ` + migrationsTable + ` WHERE version = '([^']+)'`)
+
+	fakeDbsMutex sync.Mutex
+	fakeDbs      = map[string]*fakeDb{}
+)
+
+func init() {
+	sql.Register(fakeDriverName, fakeDriver{})
+}
+
+type fakeDb struct {
+	mutex    sync.Mutex
+	applied  map[string]time.Time
+	executed []string
+}
+
+// exec records the statement, statements containing FAIL fail (without echoing the sql, like postgres).
+func (db *fakeDb) exec(query string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS "+migrationsTable) {
+		return nil
+	}
+	if strings.Contains(query, "FAIL") {
+		return errors.New("syntax error")
+	}
+	db.executed = append(db.executed, query)
+	if match := fakeInsertRegexp.FindStringSubmatch(query); match != nil {
+		db.applied[match[1]] = time.Now()
+	}
+	if match := fakeDeleteRegexp.FindStringSubmatch(query); match != nil {
+		delete(db.applied, match[1])
+	}
+	return nil
+}
+
+func (db *fakeDb) Executed() []string {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return append([]string(nil), db.executed...)
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeDbsMutex.Lock()
+	defer fakeDbsMutex.Unlock()
+	return fakeConn{db: fakeDbs[name]}, nil
+}
+
+type fakeConn struct{ db *fakeDb }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{db: c.db, query: strings.TrimSpace(query)}, nil
+}
+
+func (fakeConn) Close() error              { return nil }
+func (fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("no transactions") }
+
+type fakeStmt struct {
+	db    *fakeDb
+	query string
+}
+
+func (fakeStmt) Close() error  { return nil }
+func (fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(0), s.db.exec(s.query)
+}
+
+func (s fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	if !strings.HasPrefix(s.query, "SELECT version, applied_at FROM "+migrationsTable) {
+		return nil, errors.New("unexpected query: " + s.query)
+	}
+	s.db.mutex.Lock()
+	defer s.db.mutex.Unlock()
+	rows := &fakeRows{}
+	for version, appliedAt := range s.db.applied {
+		rows.values = append(rows.values, []driver.Value{version, appliedAt})
+	}
+	return rows, nil
+}
+
+type fakeRows struct{ values [][]driver.Value }
+
+func (*fakeRows) Columns() []string { return []string{"version", "applied_at"} }
+func (*fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// newFakeDao returns an initialized Dao on a new fake database.
+func newFakeDao(t *testing.T) (*dao.Dao, *fakeDb) {
+	t.Helper()
+	db := &fakeDb{applied: map[string]time.Time{}}
+	fakeDbsMutex.Lock()
+	fakeDbs[t.Name()] = db
+	fakeDbsMutex.Unlock()
+
+	d := dao.New("1", fakeDriverName, t.Name())
+	d.SkipMigrations = true
+	d.Logger = &writerLogger{w: io.Discard}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = d.Clean() })
+	return d, db
+}
+
+func writeMigrations(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestMigrations(t *testing.T) {
+	t.Parallel()
+
+	dir := writeMigrations(t, map[string]string{
+		"0010_c.up.sql":   "c",
+		"0002_b.up.sql":   "b",
+		"0001_a.down.sql": "a down",
+		"0001_a.up.sql":   "a",
+		"README.md":       "not a migration",
+		"0003_x.sql":      "not a migration",
+	})
+	migrations, err := NewMigrator(nil, dir).Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Migration{
+		{Version: "0001_a", UpFile: filepath.Join(dir, "0001_a.up.sql"), DownFile: filepath.Join(dir, "0001_a.down.sql")},
+		{Version: "0002_b", UpFile: filepath.Join(dir, "0002_b.up.sql")},
+		{Version: "0010_c", UpFile: filepath.Join(dir, "0010_c.up.sql")},
+	}
+	if !reflect.DeepEqual(migrations, expected) {
+		t.Errorf("expected %+v, got %+v", expected, migrations)
+	}
+
+	dir = writeMigrations(t, map[string]string{"0001_a.down.sql": "a down"})
+	if _, err := NewMigrator(nil, dir).Migrations(); err == nil {
+		t.Error("expected an error for a migration without the up file")
+	}
+}
+
+func TestMigratorUpDown(t *testing.T) {
+	t.Parallel()
+
+	c := context.Background()
+	d, db := newFakeDao(t)
+	dir := writeMigrations(t, map[string]string{
+		"0002_b.up.sql":   "create b",
+		"0001_a.up.sql":   "create a",
+		"0002_b.down.sql": "drop b",
+	})
+	m := NewMigrator(d, dir)
+
+	applied, err := m.Up(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(applied, []string{"0001_a", "0002_b"}) {
+		t.Errorf("expected ordered versions, got %v", applied)
+	}
+	executed := db.Executed()
+	if len(executed) != 2 || !strings.HasPrefix(executed[0], "create a") || !strings.HasPrefix(executed[1], "create b") {
+		t.Errorf("expected ordered migrations, got %q", executed)
+	}
+
+	// idempotent
+	if applied, err := m.Up(c); err != nil || len(applied) != 0 {
+		t.Errorf("expected nothing to apply, got %v %v", applied, err)
+	}
+	if len(db.Executed()) != 2 {
+		t.Errorf("expected no new statements, got %q", db.Executed())
+	}
+
+	reverted, err := m.Down(c, 1)
+	if err != nil || !reflect.DeepEqual(reverted, []string{"0002_b"}) {
+		t.Errorf("expected 0002_b reverted, got %v %v", reverted, err)
+	}
+	statuses, err := m.Status(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 || !statuses[0].Applied || statuses[0].AppliedAt == nil || statuses[1].Applied {
+		t.Errorf("invalid statuses: %+v", statuses)
+	}
+
+	// 0001_a has no down file
+	if reverted, err := m.Down(c, 1); err == nil || len(reverted) != 0 {
+		t.Errorf("expected a missing down migration error, got %v %v", reverted, err)
+	}
+}
+
+func TestMigratorErrorLabel(t *testing.T) {
+	t.Parallel()
+
+	c := context.Background()
+	d, _ := newFakeDao(t)
+	dir := writeMigrations(t, map[string]string{
+		"0001_a.up.sql":    "create a",
+		"0002_fail.up.sql": "FAIL with a long migration body",
+		"0003_c.up.sql":    "create c",
+	})
+	applied, err := NewMigrator(d, dir).Up(c)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !reflect.DeepEqual(applied, []string{"0001_a"}) {
+		t.Errorf("expected only 0001_a applied, got %v", applied)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "migration:0002_fail.up.sql") || strings.Contains(msg, "long migration body") {
+		t.Errorf("expected the migration label instead of its content: %s", msg)
+	}
+}
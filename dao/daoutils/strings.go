@@ -27,6 +27,18 @@ func getTimeDurationUnit(unit time.Duration) string {
 	return strings.Trim(strings.Split(unit.String(), "0")[0], "1234567890.")
 }
 
+// FormatBytes formats sizes like pg_size_pretty() (bytes, kB, MB, GB, TB)
+func FormatBytes(size int64) string {
+	units := []string{"bytes", "kB", "MB", "GB", "TB"}
+	f := float64(size)
+	unit := 0
+	for f >= 10*1024 && unit < len(units)-1 {
+		f /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.0f %s", f, units[unit])
+}
+
 type StringBuilder struct {
 	buff *bytes.Buffer
 }
@@ -0,0 +1,191 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/ansel1/merry"
+	utils "github.com/coachbit/gorm-dao/dao/daoutils"
+)
+
+// Tables with fewer (estimated) rows are never reported as sequential-scan heavy, seq scans are fine there
+const seqScanHeavyMinRows = 10_000
+
+type TableInfo struct {
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	// TableBytes is the size of the main relation (without TOAST and indexes)
+	TableBytes int64 `json:"table_bytes"`
+	IndexBytes int64 `json:"index_bytes"`
+	ToastBytes int64 `json:"toast_bytes"`
+	TotalBytes int64 `json:"total_bytes"`
+	// EstimatedRows is pg_class.reltuples (updated by vacuum/analyze), -1 if the table was never analyzed
+	EstimatedRows   int64      `json:"estimated_rows"`
+	LiveTuples      int64      `json:"live_tuples"`
+	DeadTuples      int64      `json:"dead_tuples"`
+	LastVacuum      *time.Time `json:"last_vacuum,omitempty"`
+	LastAutoVacuum  *time.Time `json:"last_autovacuum,omitempty"`
+	LastAnalyze     *time.Time `json:"last_analyze,omitempty"`
+	LastAutoAnalyze *time.Time `json:"last_autoanalyze,omitempty"`
+	SeqScans        int64      `json:"seq_scans"`
+	SeqTuplesRead   int64      `json:"seq_tuples_read"`
+	IndexScans      int64      `json:"index_scans"`
+}
+
+// DeadTupleRatio is a rough bloat estimate (dead / (live + dead) tuples).
+func (ti TableInfo) DeadTupleRatio() float64 {
+	if ti.LiveTuples+ti.DeadTuples == 0 {
+		return 0
+	}
+	return float64(ti.DeadTuples) / float64(ti.LiveTuples+ti.DeadTuples)
+}
+
+// SeqScanHeavy is true for big tables which are read with sequential scans more often than with indexes.
+func (ti TableInfo) SeqScanHeavy() bool {
+	return ti.LiveTuples >= seqScanHeavyMinRows && ti.SeqScans > ti.IndexScans
+}
+
+func (ti TableInfo) lastVacuum() *time.Time  { return latest(ti.LastVacuum, ti.LastAutoVacuum) }
+func (ti TableInfo) lastAnalyze() *time.Time { return latest(ti.LastAnalyze, ti.LastAutoAnalyze) }
+
+func latest(t1, t2 *time.Time) *time.Time {
+	if t1 == nil || (t2 != nil && t2.After(*t1)) {
+		return t2
+	}
+	return t1
+}
+
+// UnusedIndex is a (non unique, non primary key) index never used since the statistics were reset.
+type UnusedIndex struct {
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	Index  string `json:"index"`
+	Bytes  int64  `json:"bytes"`
+}
+
+type DbInfoReport struct {
+	Schemas       []string      `json:"schemas"`
+	Tables        []TableInfo   `json:"tables"`
+	UnusedIndexes []UnusedIndex `json:"unused_indexes"`
+	// SeqScanHeavy are "schema.table" names, see TableInfo.SeqScanHeavy()
+	SeqScanHeavy []string `json:"seq_scan_heavy"`
+}
+
+func (r DbInfoReport) JSON() ([]byte, error) {
+	byts, err := json.MarshalIndent(r, "", "  ")
+	return byts, merry.Wrap(err)
+}
+
+func (r DbInfoReport) String() string {
+	sb := utils.NewStringBuilder()
+	sb.Appendf("%-40s %10s %10s %10s %10s %12s %12s %6s %16s %16s\n", "table", "table", "indexes", "toast", "total", "est. rows", "dead tuples", "dead%", "last vacuum", "last analyze")
+	for _, ti := range r.Tables {
+		sb.Appendf("%-40s %10s %10s %10s %10s %12d %12d %5.1f%% %16s %16s\n",
+			ti.Schema+"."+ti.Table,
+			utils.FormatBytes(ti.TableBytes), utils.FormatBytes(ti.IndexBytes), utils.FormatBytes(ti.ToastBytes), utils.FormatBytes(ti.TotalBytes),
+			ti.EstimatedRows, ti.DeadTuples, 100*ti.DeadTupleRatio(), formatInfoTime(ti.lastVacuum()), formatInfoTime(ti.lastAnalyze()))
+	}
+	if len(r.UnusedIndexes) > 0 {
+		sb.Appendln()
+		sb.Appendln("Unused indexes:")
+		for _, idx := range r.UnusedIndexes {
+			sb.Appendf("%40s on %s.%s (%s)\n", idx.Index, idx.Schema, idx.Table, utils.FormatBytes(idx.Bytes))
+		}
+	}
+	if len(r.SeqScanHeavy) > 0 {
+		sb.Appendln()
+		sb.Appendln("Sequential-scan heavy tables:")
+		for _, table := range r.SeqScanHeavy {
+			sb.Appendf("%40s\n", table)
+		}
+	}
+	return sb.String()
+}
+
+func formatInfoTime(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return t.UTC().Format("2006-01-02 15:04")
+}
+
+// DbInfo returns the DetailedDbInfo() of the "public" schema, as string.
+func (d *Dao) DbInfo(c context.Context) (string, error) {
+	report, err := d.DetailedDbInfo(c)
+	if err != nil {
+		return "", err
+	}
+	return report.String(), nil
+}
+
+// DetailedDbInfo loads sizes, vacuum/analyze info and usage statistics (empty schemas means "public").
+func (d *Dao) DetailedDbInfo(c context.Context, schemas ...string) (*DbInfoReport, error) {
+	if len(schemas) == 0 {
+		schemas = []string{defaultSchema}
+	}
+	res := &DbInfoReport{Schemas: schemas, Tables: []TableInfo{}, UnusedIndexes: []UnusedIndex{}, SeqScanHeavy: []string{}}
+	q := d.Query(c)
+
+	if err := loadTableInfos(q, res); err != nil {
+		return nil, err
+	}
+	if err := loadUnusedIndexes(q, res); err != nil {
+		return nil, err
+	}
+	for _, ti := range res.Tables {
+		if ti.SeqScanHeavy() {
+			res.SeqScanHeavy = append(res.SeqScanHeavy, ti.Schema+"."+ti.Table)
+		}
+	}
+	return res, nil
+}
+
+func loadTableInfos(q *Query, res *DbInfoReport) error {
+	rows, err := q.RawRows(`select n.nspname, c.relname,
+	pg_relation_size(c.oid), pg_indexes_size(c.oid), coalesce(pg_total_relation_size(nullif(c.reltoastrelid, 0)), 0), pg_total_relation_size(c.oid),
+	c.reltuples::bigint, coalesce(s.n_live_tup, 0), coalesce(s.n_dead_tup, 0),
+	s.last_vacuum, s.last_autovacuum, s.last_analyze, s.last_autoanalyze,
+	coalesce(s.seq_scan, 0), coalesce(s.seq_tup_read, 0), coalesce(s.idx_scan, 0)
+from pg_class c
+join pg_namespace n on n.oid = c.relnamespace
+left join pg_stat_user_tables s on s.relid = c.oid
+where c.relkind in ('r', 'p') and n.nspname in (?)
+order by pg_total_relation_size(c.oid) desc, n.nspname, c.relname`, res.Schemas)
+	if err != nil {
+		return err
+	}
+	defer utils.CloseCloser(rows)
+	for rows.Next() {
+		var ti TableInfo
+		if err := rows.Scan(&ti.Schema, &ti.Table,
+			&ti.TableBytes, &ti.IndexBytes, &ti.ToastBytes, &ti.TotalBytes,
+			&ti.EstimatedRows, &ti.LiveTuples, &ti.DeadTuples,
+			&ti.LastVacuum, &ti.LastAutoVacuum, &ti.LastAnalyze, &ti.LastAutoAnalyze,
+			&ti.SeqScans, &ti.SeqTuplesRead, &ti.IndexScans); err != nil {
+			return merry.Wrap(err)
+		}
+		res.Tables = append(res.Tables, ti)
+	}
+	return merry.Wrap(rows.Err())
+}
+
+func loadUnusedIndexes(q *Query, res *DbInfoReport) error {
+	rows, err := q.RawRows(`select s.schemaname, s.relname, s.indexrelname, pg_relation_size(s.indexrelid)
+from pg_stat_user_indexes s
+join pg_index i on i.indexrelid = s.indexrelid
+where s.idx_scan = 0 and not i.indisunique and not i.indisprimary and s.schemaname in (?)
+order by pg_relation_size(s.indexrelid) desc, s.indexrelname`, res.Schemas)
+	if err != nil {
+		return err
+	}
+	defer utils.CloseCloser(rows)
+	for rows.Next() {
+		var idx UnusedIndex
+		if err := rows.Scan(&idx.Schema, &idx.Table, &idx.Index, &idx.Bytes); err != nil {
+			return merry.Wrap(err)
+		}
+		res.UnusedIndexes = append(res.UnusedIndexes, idx)
+	}
+	return merry.Wrap(rows.Err())
+}
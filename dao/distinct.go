@@ -0,0 +1,84 @@
+package dao
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/ansel1/merry"
+	"github.com/jinzhu/gorm"
+)
+
+// orderDirectionRegexp matches the direction (and nulls ordering) suffix of order by expressions
+var orderDirectionRegexp = regexp.MustCompile(`(?i)(\s+(asc|desc))?(\s+nulls\s+(first|last))?\s*$`)
+
+// Distinct removes duplicate rows (`SELECT DISTINCT *`), Count() counts the distinct rows.
+func (q *Query) Distinct() *Query {
+	q.logStr = append(q.logStr, "distinct")
+	q.distinct = "DISTINCT"
+	q.distinctOn = nil
+	return q
+}
+
+// DistinctOn keeps the first row of every group of rows with equal column values (`SELECT DISTINCT ON (cols) *`), for
+// example the latest row per group with:
+//
+//	q.DistinctOn("user_id").OrderByAsc("user_id").OrderByDesc("created_at")
+//
+// Postgres requires the leftmost order by expressions to match the DISTINCT ON columns, Count() counts the groups. The
+// columns are validated and quoted.
+func (q *Query) DistinctOn(columns ...string) *Query {
+	if len(columns) == 0 {
+		q.err = firstErr(q.err, merry.New("no distinct on columns"))
+		return q
+	}
+	quoted := make([]string, len(columns))
+	for n, col := range columns {
+		quoted[n] = q.column(col)
+	}
+	q.logStr = append(q.logStr, "distinct_on:"+strings.Join(columns, ","))
+	q.distinct = "DISTINCT ON (" + strings.Join(quoted, ", ") + ")"
+	q.distinctOn = quoted
+	return q
+}
+
+// selectExpr prefixes the selected columns with the DISTINCT (ON) clause.
+func (q *Query) selectExpr(columns string) string {
+	if q.distinct == "" {
+		return columns
+	}
+	return q.distinct + " " + columns
+}
+
+func (q *Query) validateDistinctOn() error {
+	for n := 0; n < len(q.distinctOn) && n < len(q.orderBy); n++ {
+		ord := normalizeOrderExpr(q.orderBy[n].expr)
+		found := false
+		for _, col := range q.distinctOn {
+			found = found || normalizeOrderExpr(col) == ord
+		}
+		if !found {
+			return merry.New("distinct on columns must match the leftmost order by expressions").
+				Appendf("distinct on (%s), order by %s", strings.Join(q.distinctOn, ", "), q.orderBy[n].expr)
+		}
+	}
+	return nil
+}
+
+func normalizeOrderExpr(expr string) string {
+	expr = orderDirectionRegexp.ReplaceAllString(strings.TrimSpace(expr), "")
+	return strings.ToLower(strings.ReplaceAll(expr, `"`, ""))
+}
+
+// distinctCountDb counts the distinct rows with `SELECT count(*) FROM (SELECT DISTINCT ...) AS count_table`, the
+// returned values are the values of the inner query.
+func (q *Query) distinctCountDb(db *gorm.DB, sample interface{}) (*gorm.DB, []interface{}, error) {
+	inner, sourceValues, err := q.sourceDb(db.Select(q.selectExpr("*")), sample)
+	if err != nil {
+		return nil, nil, err
+	}
+	sql, values, err := q.renderSelect(inner, sourceValues)
+	if err != nil {
+		return nil, nil, err
+	}
+	return q.gormDb.New().Table("(" + sql + ") AS count_table").Select("count(*)"), values, nil
+}
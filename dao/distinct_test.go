@@ -0,0 +1,30 @@
+package dao
+
+import (
+	"context"
+	"testing"
+)
+
+type distinctModel struct {
+	BaseModel
+	UserID string
+}
+
+func TestDistinctOn(t *testing.T) {
+	t.Parallel()
+
+	d := New("1", "postgres", "", &distinctModel{})
+	sql, _, err := d.Query(context.Background()).DistinctOn("user_id").OrderByAsc("user_id").OrderByDesc("created_at").ToSQL(&distinctModel{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `SELECT DISTINCT ON ("user_id") * FROM "distinct_models"   ORDER BY "user_id" asc,"created_at" desc LIMIT 50`
+	if sql != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, sql)
+	}
+
+	sql, _, err = d.Query(context.Background()).DistinctOn("email) * from users; drop table x; --").ToSQL(&distinctModel{})
+	if err == nil {
+		t.Errorf("expected an invalid column error, got %q", sql)
+	}
+}
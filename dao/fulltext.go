@@ -0,0 +1,215 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/ansel1/merry"
+	utils "github.com/coachbit/gorm-dao/dao/daoutils"
+	"github.com/gofrs/uuid"
+)
+
+// defaultGeneratedTextSearchConfig is used for generated tsvector columns, they can't depend on the server's
+// default_text_search_config
+const defaultGeneratedTextSearchConfig = "simple"
+
+// FulltextMode is how the search text is converted to a tsquery.
+type FulltextMode int
+
+const (
+	// FulltextWebsearch accepts any user input, with web search syntax (`"quoted phrase"`, `or`, `-excluded`)
+	FulltextWebsearch FulltextMode = iota
+	// FulltextPlain matches all words of the text, punctuation is ignored
+	FulltextPlain
+	// FulltextPrefix matches all words of the text as prefixes (`gre` matches `green`), for search-as-you-type
+	FulltextPrefix
+)
+
+// FulltextColumn is a searched column with its weight (A, B, C or D, the default). Weights matter only for ranking.
+type FulltextColumn struct {
+	Name   string
+	Weight string
+}
+
+type FulltextOptions struct {
+	// Config is the text search configuration (`english`, `german`, `simple`...), the server's default if empty
+	Config string
+	// Columns are the searched columns, ignored if Vector is set
+	Columns []FulltextColumn
+	// Vector is a stored tsvector column (see AddFulltextColumn()), used instead of computing the vector from Columns
+	Vector string
+	Mode   FulltextMode
+	// Rank orders the results by relevance (ts_rank), after previously added orderings
+	Rank bool
+}
+
+type fulltextSearch struct {
+	config      string
+	vector      string
+	query       string
+	queryValues []interface{}
+}
+
+// RankedFulltextSearch filters rows matching the text with postgres fulltext search, an empty text doesn't filter. With
+// opts.Rank the rows are ordered by relevance, and Headlines() can be used for highlighted snippets.
+func (q *Query) RankedFulltextSearch(text string, opts FulltextOptions) *Query {
+	config, err := textSearchConfigArg(opts.Config)
+	if err != nil {
+		q.err = err
+		return q
+	}
+	var vector string
+	if opts.Vector != "" {
+		vector, err = quoteColumn(opts.Vector)
+	} else {
+		vector, err = tsvectorExpr(config, opts.Columns)
+	}
+	if err != nil {
+		q.err = err
+		return q
+	}
+
+	var query string
+	var values []interface{}
+	switch opts.Mode {
+	case FulltextWebsearch:
+		query, values = "websearch_to_tsquery("+config+"?)", []interface{}{text}
+	case FulltextPlain:
+		query, values = "plainto_tsquery("+config+"?)", []interface{}{text}
+	case FulltextPrefix:
+		words := fulltextWords(text)
+		for n := range words {
+			words[n] += ":*"
+		}
+		text = strings.Join(words, " & ")
+		query, values = "to_tsquery("+config+"?)", []interface{}{text}
+	default:
+		q.err = merry.New("invalid fulltext mode").Appendf("mode: %d", opts.Mode)
+		return q
+	}
+	q.fulltext = &fulltextSearch{config: config, vector: vector, query: query, queryValues: values}
+
+	if strings.TrimSpace(text) == "" {
+		return q
+	}
+	q.appendFilterExpressionAndValues("fulltext", "("+vector+") @@ "+query, values...)
+	if opts.Rank {
+		q.OrderByRawExpression("ts_rank("+vector+", "+query+") desc", values...)
+	}
+	return q
+}
+
+// Headlines returns highlighted snippets (ts_headline) of the column for the rows All() would return, by primary key
+// (which must be a uuid, as in BaseModel). The query must have a RankedFulltextSearch(). The options are ts_headline
+// options, for example `StartSel=<mark>, StopSel=</mark>, MaxFragments=2`.
+func (q *Query) Headlines(sample Model, column, options string) (map[uuid.UUID]string, error) {
+	if q.fulltext == nil {
+		return nil, merry.New("headlines without fulltext search")
+	}
+	scope := q.gormDb.NewScope(sample)
+	pk := scope.PrimaryField()
+	if pk == nil || pk.Struct.Type != reflect.TypeOf(uuid.UUID{}) {
+		return nil, merry.New("headlines need a uuid primary key").Appendf("model: %T", sample)
+	}
+	sql, values, err := q.renderQuery(QueryModeAll, sample)
+	if err != nil {
+		return nil, err
+	}
+	quoted, err := quoteColumn(column)
+	if err != nil {
+		return nil, err
+	}
+	fts := q.fulltext
+	headlineSQL := fmt.Sprintf("SELECT %s, ts_headline(%scoalesce(%s::text, ''), %s, ?) FROM (%s) AS fulltext_rows",
+		scope.Quote(pk.DBName), fts.config, quoted, fts.query, sql)
+	headlineValues := append(append(append([]interface{}{}, fts.queryValues...), options), values...)
+
+	rows, err := q.RawRows(headlineSQL, headlineValues...)
+	if err != nil {
+		return nil, err
+	}
+	defer utils.CloseCloser(rows)
+	res := map[uuid.UUID]string{}
+	for rows.Next() {
+		var id uuid.UUID
+		var headline string
+		if err := rows.Scan(&id, &headline); err != nil {
+			return nil, merry.Wrap(err)
+		}
+		res[id] = headline
+	}
+	return res, merry.Wrap(rows.Err())
+}
+
+// AddFulltextColumn adds a stored generated tsvector column to the model's table (with a GIN index), to be used with
+// FulltextOptions.Vector. The config is "simple" if empty. Only the index is registered, if SkipMigrations is set.
+func (d *Dao) AddFulltextColumn(c context.Context, model Model, column, config string, columns ...FulltextColumn) error {
+	if config == "" {
+		config = defaultGeneratedTextSearchConfig
+	}
+	configArg, err := textSearchConfigArg(config)
+	if err != nil {
+		return err
+	}
+	vector, err := tsvectorExpr(configArg, columns)
+	if err != nil {
+		return err
+	}
+	table := d.metaDb().NewScope(model).TableName()
+	idx := d.registerIndex(IndexInfo{Name: table + "_" + column + "_idx", Table: table, Columns: []string{column}, Method: "gin"})
+	if d.SkipMigrations {
+		return nil
+	}
+
+	sql := fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s tsvector GENERATED ALWAYS AS (%s) STORED",
+		QuoteIdentifier(table), QuoteIdentifier(column), vector)
+	if _, err := d.Exec(c, sql); err != nil {
+		return merry.Wrap(err).Appendf("adding fulltext column %s", column)
+	}
+	return d.createIndex(idx)
+}
+
+// textSearchConfigArg renders the config as the first ts function argument (empty for the server's default).
+func textSearchConfigArg(config string) (string, error) {
+	if config == "" {
+		return "", nil
+	}
+	if !identifierRegexp.MatchString(config) {
+		return "", merry.New("invalid text search config").Appendf("config: %s", config)
+	}
+	return "'" + config + "'::regconfig, ", nil
+}
+
+// tsvectorExpr concatenates the (weighted) columns' vectors, NULL columns are ignored.
+func tsvectorExpr(config string, columns []FulltextColumn) (string, error) {
+	if len(columns) == 0 {
+		return "", merry.New("no fulltext columns")
+	}
+	parts := make([]string, len(columns))
+	for n, col := range columns {
+		name, err := quoteColumn(col.Name)
+		if err != nil {
+			return "", err
+		}
+		vector := "to_tsvector(" + config + "coalesce(" + name + "::text, ''))"
+		switch weight := strings.ToUpper(col.Weight); weight {
+		case "":
+		case "A", "B", "C", "D":
+			vector = "setweight(" + vector + ", '" + weight + "')"
+		default:
+			return "", merry.New("invalid fulltext weight").Appendf("%s: %s", col.Name, col.Weight)
+		}
+		parts[n] = vector
+	}
+	return strings.Join(parts, " || "), nil
+}
+
+// fulltextWords splits the text into words, without any tsquery operators.
+func fulltextWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,35 @@
+package dao
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+type fulltextModel struct {
+	BaseModel
+	Title string
+	Body  string
+}
+
+func TestFulltextSearch(t *testing.T) {
+	t.Parallel()
+
+	d := New("1", "postgres", "", &fulltextModel{})
+	sql, values, err := d.Query(context.Background()).FulltextSearch([]string{"title", "body"}, []string{"a & b", "c"}).ToSQL(&fulltextModel{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `SELECT * FROM "fulltext_models"  WHERE ( (to_tsvector(concat( "title" , ' ',  "body" )) @@  to_tsquery( $1 ) ) ) LIMIT 50`
+	if sql != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, sql)
+	}
+	if !reflect.DeepEqual(values, []interface{}{"a & b & c"}) {
+		t.Errorf("invalid values: %#v", values)
+	}
+
+	sql, _, err = d.Query(context.Background()).FulltextSearch([]string{"email); drop table x; --"}, []string{"a"}).ToSQL(&fulltextModel{})
+	if err == nil {
+		t.Errorf("expected an invalid column error, got %q", sql)
+	}
+}
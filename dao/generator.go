@@ -3,75 +3,278 @@ package dao
 import (
 	"bytes"
 	"fmt"
+	"go/format"
 	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/ansel1/merry"
 	"github.com/jinzhu/gorm"
-	"github.com/tkrajina/go-reflector/reflector"
 )
 
-func GenerateColumnNames(targetFile, tabledMd string, models ...interface{}) error {
-	fmt.Printf("Generating %s from %#v\n", targetFile, models)
-	f, err := os.Create(targetFile)
+const defaultGeneratedPackage = "appmodels"
+
+type GeneratorOptions struct {
+	// Package of the generated file, "appmodels" if empty. ColumnXxx() methods are generated only for models from
+	// this package.
+	Package string
+	// TargetFile is the generated go file
+	TargetFile string
+	// TablesMd is the generated markdown file (optional)
+	TablesMd string
+	// Dialect is the gorm dialect used to resolve table names, "postgres" if empty
+	Dialect string
+}
+
+type modelInfo struct {
+	name    string
+	pkgName string
+	table   string
+	fields  []*gorm.StructField
+	// relationships are the association fields (not columns)
+	relationships []*gorm.StructField
+}
+
+func newModelInfo(db *gorm.DB, model interface{}) (*modelInfo, error) {
+	ty := reflect.TypeOf(model)
+	for ty != nil && ty.Kind() == reflect.Ptr {
+		ty = ty.Elem()
+	}
+	if ty == nil || ty.Kind() != reflect.Struct {
+		return nil, merry.New("model must be a struct").Appendf("found %T", model)
+	}
+	scope := db.NewScope(model)
+	res := &modelInfo{
+		name:    ty.Name(),
+		pkgName: path.Base(ty.PkgPath()),
+		table:   scope.TableName(),
+	}
+	for _, field := range scope.GetModelStruct().StructFields {
+		if field.IsNormal && !field.IsIgnored {
+			res.fields = append(res.fields, field)
+		} else if field.Relationship != nil && !field.IsIgnored {
+			res.relationships = append(res.relationships, field)
+		}
+	}
+	return res, nil
+}
+
+func modelInfos(dialect string, models ...interface{}) ([]*modelInfo, error) {
+	db, err := offlineGormDb(dialect)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	var res []*modelInfo
+	for _, model := range models {
+		mi, err := newModelInfo(db, model)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, mi)
 	}
-	md, err := os.Create(tabledMd)
+	return res, nil
+}
+
+// GenerateColumnNames generates column constants into the "appmodels" package.
+func GenerateColumnNames(targetFile, tabledMd string, models ...interface{}) error {
+	return GenerateColumns(GeneratorOptions{TargetFile: targetFile, TablesMd: tabledMd}, models...)
+}
+
+func GenerateColumns(opts GeneratorOptions, models ...interface{}) error {
+	fmt.Printf("Generating %s from %d models\n", opts.TargetFile, len(models))
+	code, md, err := GenerateColumnsCode(opts, models...)
 	if err != nil {
 		return err
 	}
+	if err := os.WriteFile(opts.TargetFile, code, 0644); err != nil {
+		return merry.Wrap(err).Appendf("writing %s", opts.TargetFile)
+	}
+	if opts.TablesMd != "" {
+		if err := os.WriteFile(opts.TablesMd, md, 0644); err != nil {
+			return merry.Wrap(err).Appendf("writing %s", opts.TablesMd)
+		}
+	}
+	return nil
+}
 
-	_, _ = f.WriteString("package appmodels\n")
-	_, _ = f.WriteString("/* Run 'go generate' to regenerate this file */\n\n")
+// GenerateColumnsCode returns the gofmt-ed code and the markdown without writing them. The output depends only on
+// the models (and their order), so it can be used to check if generated files are up to date.
+func GenerateColumnsCode(opts GeneratorOptions, models ...interface{}) (code []byte, md []byte, err error) {
+	pkg := opts.Package
+	if pkg == "" {
+		pkg = defaultGeneratedPackage
+	}
+	infos, err := modelInfos(opts.Dialect, models...)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	_, _ = md.WriteString("# Database tables\n")
-	_, _ = md.WriteString("Run 'go generate' to regenerate this file\n\n")
+	var mdBuf bytes.Buffer
+	mdBuf.WriteString("# Database tables\n")
+	mdBuf.WriteString("Run 'go generate' to regenerate this file\n\n")
 
 	var declarationCode bytes.Buffer
 	var initializationCode bytes.Buffer
-	var code bytes.Buffer
+	var methodsCode bytes.Buffer
+	var queryBuildersCode bytes.Buffer
+	imports := newGeneratedImports(pkg)
 
-	//f.WriteString("type FieldName string\n")
-	for _, model := range models {
-		obj := reflector.New(model)
-		name := obj.Type().Name()
-		if obj.IsPtr() {
-			name = obj.Type().Elem().Name()
-		}
-		fmt.Println("Generating", name)
-		_, _ = md.WriteString("# " + name + "\n\n")
-		declarationCode.WriteString(fmt.Sprintf("%s struct {\n", name))
-		for _, field := range obj.FieldsFlattened() {
-			gormTag, _ := field.Tag("gorm")
-			if gormTag != "-" {
-				gormFieldName := gorm.ToDBName(field.Name())
-				parts := strings.Split(gormTag, ";")
-				for _, part := range parts {
-					parts2 := strings.Split(part, ":")
-					if len(parts2) >= 2 && strings.ToLower(parts2[0]) == "column" {
-						gormFieldName = parts2[1]
-					}
-				}
-				_, _ = md.WriteString("* " + field.Name() + "\n")
-				declarationCode.WriteString(fmt.Sprintf("%s string\n", field.Name()))
-				initializationCode.WriteString(fmt.Sprintf("Columns.%s.%s = \"%s\"\n", name, field.Name(), gormFieldName))
-
-				modelName := strings.Split(obj.Type().String(), ".")[1]
-				code.WriteString(fmt.Sprintf(`func (m *%s) Column%s() (string, interface{}) { return "%s", m.%s }
-`, modelName, field.Name(), gormFieldName, field.Name()))
+	var infoDeclarationCode, infoInitializationCode bytes.Buffer
+	for _, mi := range infos {
+		mdBuf.WriteString("# " + mi.name + "\n\n")
+		declarationCode.WriteString(fmt.Sprintf("%s struct {\n", mi.name))
+		infoDeclarationCode.WriteString(fmt.Sprintf("%s struct {\n", mi.name))
+		for _, field := range mi.fields {
+			mdBuf.WriteString("* " + field.Name + "\n")
+			declarationCode.WriteString(fmt.Sprintf("%s string\n", field.Name))
+			infoDeclarationCode.WriteString(fmt.Sprintf("%s dao.Column\n", field.Name))
+			initializationCode.WriteString(fmt.Sprintf("Columns.%s.%s = %q\n", mi.name, field.Name, field.DBName))
+			infoInitializationCode.WriteString(fmt.Sprintf("ColumnInfos.%s.%s = dao.Column{Table: %q, Name: %q, GoType: %q}\n", mi.name, field.Name, mi.table, field.DBName, goTypeName(field.Struct.Type)))
+			if mi.pkgName == pkg {
+				methodsCode.WriteString(fmt.Sprintf("func (m *%s) Column%s() (string, interface{}) { return %q, m.%s }\n", mi.name, field.Name, field.DBName, field.Name))
 			}
 		}
 		declarationCode.WriteString("}\n")
-		_, _ = md.WriteString("\n")
+		infoDeclarationCode.WriteString("}\n")
+		mdBuf.WriteString("\n")
+		writeQueryBuilder(&queryBuildersCode, mi, imports)
 	}
-	_, _ = f.WriteString("var Columns struct {\n")
-	_, _ = f.WriteString(declarationCode.String())
-	_, _ = f.WriteString("}\n")
-	_, _ = f.WriteString("// nolint\n")
-	_, _ = f.WriteString("func init() {\n")
-	_, _ = f.WriteString(initializationCode.String())
-	_, _ = f.WriteString("}\n")
-	_, _ = f.WriteString(code.String())
 
-	return nil
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by gorm-dao. DO NOT EDIT.\n")
+	buf.WriteString("// Run 'go generate' to regenerate this file\n\n")
+	buf.WriteString("package " + pkg + "\n\n")
+	buf.WriteString(imports.code())
+	buf.WriteString("// Columns are the column names\n")
+	buf.WriteString("var Columns struct {\n")
+	buf.WriteString(declarationCode.String())
+	buf.WriteString("}\n\n")
+	buf.WriteString("// ColumnInfos are the columns with their tables and go types, see also the <Model>Q query builders\n")
+	buf.WriteString("var ColumnInfos struct {\n")
+	buf.WriteString(infoDeclarationCode.String())
+	buf.WriteString("}\n\n")
+	buf.WriteString("// nolint\n")
+	buf.WriteString("func init() {\n")
+	buf.WriteString(initializationCode.String())
+	buf.WriteString(infoInitializationCode.String())
+	buf.WriteString("}\n\n")
+	buf.WriteString(methodsCode.String())
+	buf.WriteString("\n")
+	buf.WriteString(queryBuildersCode.String())
+
+	code, err = format.Source(buf.Bytes())
+	if err != nil {
+		return nil, nil, merry.Wrap(err).Append("formatting generated code")
+	}
+	return code, mdBuf.Bytes(), nil
+}
+
+// writeQueryBuilder writes the `<Model>Q` variable with typed columns, used as `Query.Where(UserQ.Email.Eq("x"))`.
+func writeQueryBuilder(code *bytes.Buffer, mi *modelInfo, imports *generatedImports) {
+	var declaration, initialization bytes.Buffer
+	for _, field := range mi.fields {
+		ty := field.Struct.Type
+		for ty.Kind() == reflect.Ptr {
+			ty = ty.Elem()
+		}
+		var colType, constructor string
+		switch {
+		case ty == reflect.TypeOf(""):
+			colType, constructor = "dao.StringColumn", "dao.NewStringColumn"
+		case ty == reflect.TypeOf(time.Time{}):
+			colType, constructor = "dao.TimeColumn", "dao.NewTimeColumn"
+		default:
+			typeExpr := imports.typeExpr(ty)
+			colType, constructor = "dao.TypedColumn["+typeExpr+"]", "dao.NewTypedColumn["+typeExpr+"]"
+		}
+		declaration.WriteString(fmt.Sprintf("%s %s\n", field.Name, colType))
+		initialization.WriteString(fmt.Sprintf("%s: %s(%q, %q),\n", field.Name, constructor, mi.table, field.DBName))
+	}
+	code.WriteString(fmt.Sprintf("var %sQ = struct {\n%s}{\n%s}\n\n", mi.name, declaration.String(), initialization.String()))
+}
+
+// qualifiedTypeRegexp matches package qualified names (`github.com/x/models.Settings`, `time.Time`)
+var qualifiedTypeRegexp = regexp.MustCompile(`[\w.\-~/]+\.[A-Za-z_]\w*`)
+
+type generatedImports struct {
+	pkg     string
+	byPath  map[string]string
+	byAlias map[string]string
+}
+
+func newGeneratedImports(pkg string) *generatedImports {
+	gi := &generatedImports{
+		pkg:     pkg,
+		byPath:  map[string]string{},
+		byAlias: map[string]string{},
+	}
+	gi.alias("github.com/coachbit/gorm-dao/dao")
+	return gi
+}
+
+func (gi *generatedImports) alias(pkgPath string) string {
+	if alias, found := gi.byPath[pkgPath]; found {
+		return alias
+	}
+	base := path.Base(pkgPath)
+	alias := base
+	for n := 2; gi.byAlias[alias] != "" || alias == gi.pkg; n++ {
+		alias = fmt.Sprintf("%s%d", base, n)
+	}
+	gi.byPath[pkgPath] = alias
+	gi.byAlias[alias] = pkgPath
+	return alias
+}
+
+// typeExpr renders the type as go code, types from the generated package are not qualified.
+func (gi *generatedImports) typeExpr(ty reflect.Type) string {
+	if ty.Name() != "" {
+		// generic type names contain fully qualified type arguments (`JSONB[github.com/x/models.Settings]`)
+		name := qualifiedTypeRegexp.ReplaceAllStringFunc(ty.Name(), func(qualified string) string {
+			dot := strings.LastIndex(qualified, ".")
+			return gi.qualify(qualified[:dot], qualified[dot+1:])
+		})
+		return gi.qualify(ty.PkgPath(), name)
+	}
+	switch ty.Kind() {
+	case reflect.Ptr:
+		return "*" + gi.typeExpr(ty.Elem())
+	case reflect.Slice:
+		return "[]" + gi.typeExpr(ty.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", ty.Len(), gi.typeExpr(ty.Elem()))
+	case reflect.Map:
+		return "map[" + gi.typeExpr(ty.Key()) + "]" + gi.typeExpr(ty.Elem())
+	}
+	return "interface{}"
+}
+
+func (gi *generatedImports) qualify(pkgPath, name string) string {
+	if pkgPath == "" || path.Base(pkgPath) == gi.pkg {
+		return name
+	}
+	return gi.alias(pkgPath) + "." + name
+}
+
+func (gi *generatedImports) code() string {
+	paths := make([]string, 0, len(gi.byPath))
+	for pkgPath := range gi.byPath {
+		paths = append(paths, pkgPath)
+	}
+	sort.Strings(paths)
+
+	var res bytes.Buffer
+	res.WriteString("import (\n")
+	for _, pkgPath := range paths {
+		if alias := gi.byPath[pkgPath]; alias != path.Base(pkgPath) {
+			res.WriteString(alias + " ")
+		}
+		res.WriteString(fmt.Sprintf("%q\n", pkgPath))
+	}
+	res.WriteString(")\n\n")
+	return res.String()
 }
@@ -0,0 +1,227 @@
+package dao
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/ansel1/merry"
+	utils "github.com/coachbit/gorm-dao/dao/daoutils"
+)
+
+type SchemaDocsOptions struct {
+	Title string
+	// Introspect adds the live database types, nullability, defaults, indexes and foreign keys (the Dao must be
+	// initialized)
+	Introspect bool
+	// Schema is used only with Introspect, "public" if empty
+	Schema string
+}
+
+func (d *Dao) modelInfos() ([]*modelInfo, error) {
+	var res []*modelInfo
+	for _, model := range d.models {
+		mi, err := newModelInfo(d.metaDb(), model)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, mi)
+	}
+	return res, nil
+}
+
+// GenerateSchemaDocs writes the markdown schema documentation of the registered models.
+func (d *Dao) GenerateSchemaDocs(c context.Context, targetFile string, opts SchemaDocsOptions) error {
+	md, err := d.SchemaDocs(c, opts)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(targetFile, md, 0644); err != nil {
+		return merry.Wrap(err).Appendf("writing %s", targetFile)
+	}
+	return nil
+}
+
+// SchemaDocs renders markdown with columns, types, indexes (with their validation messages), foreign keys and a
+// mermaid ER diagram of the registered models.
+func (d *Dao) SchemaDocs(c context.Context, opts SchemaDocsOptions) ([]byte, error) {
+	infos, err := d.modelInfos()
+	if err != nil {
+		return nil, err
+	}
+	var live *DbSchema
+	if opts.Introspect {
+		if live, err = d.IntrospectSchema(c, opts.Schema); err != nil {
+			return nil, err
+		}
+	}
+
+	db := d.metaDb()
+	md := utils.NewStringBuilder()
+	md.Appendln("# " + utils.FirstNonEmpty(opts.Title, "Database tables"))
+	md.Appendln()
+	md.Appendln("Run 'go generate' to regenerate this file")
+	md.Appendln()
+
+	var diagram []string
+	for _, mi := range infos {
+		var liveTable *DbTable
+		if live != nil {
+			liveTable = live.Tables[mi.table]
+		}
+		columns := modelColumns(db, mi)
+		indexes := d.modelIndexes(mi)
+		foreignKeys := modelForeignKeys(db, mi, infos)
+
+		md.Appendf("## %s (%s)\n\n", mi.table, mi.name)
+		if live != nil && liveTable == nil {
+			md.Appendln("**Table not found in the database**")
+			md.Appendln()
+		}
+		md.Appendln("| Column | Go field | SQL type | Nullable | Default | Key |")
+		md.Appendln("|--------|----------|----------|----------|---------|-----|")
+		entity := []string{"    " + mi.table + " {"}
+		for _, col := range columns {
+			sqlType, nullable, dflt := col.SQLType, col.Nullable, col.Default
+			if liveTable != nil {
+				if liveCol, found := liveTable.Column(col.Name); found {
+					sqlType, nullable, dflt = liveCol.DataType, liveCol.Nullable, liveCol.Default
+				} else {
+					sqlType += " (missing in db)"
+				}
+			}
+			var keys []string
+			if col.Primary {
+				keys = append(keys, "PK")
+			}
+			for _, fk := range foreignKeys {
+				if fk.Column == col.Name {
+					keys = append(keys, "FK")
+				}
+			}
+			if col.Unique {
+				keys = append(keys, "UK")
+			}
+			md.Appendf("| %s | %s `%s` | %s | %s | %s | %s |\n", col.Name, col.GoField, col.GoType, sqlType, yesNo(nullable), mdCode(dflt), strings.Join(keys, ", "))
+			entity = append(entity, "        "+mermaidIdentifier(sqlType)+" "+col.Name+mermaidKeys(keys))
+		}
+		if liveTable != nil {
+			for _, liveCol := range liveTable.Columns {
+				if !modelHasColumn(columns, liveCol.Name) {
+					md.Appendf("| %s | (not in model) | %s | %s | %s | |\n", liveCol.Name, liveCol.DataType, yesNo(liveCol.Nullable), mdCode(liveCol.Default))
+				}
+			}
+		}
+		md.Appendln()
+		entity = append(entity, "    }")
+		diagram = append(diagram, entity...)
+
+		if len(indexes) > 0 || (liveTable != nil && len(liveTable.Indexes) > 0) {
+			md.Appendln("### Indexes")
+			md.Appendln()
+			md.Appendln("| Name | Columns | Unique | Validation message |")
+			md.Appendln("|------|---------|--------|--------------------|")
+			for _, idx := range indexes {
+				md.Appendf("| %s | %s | %s | %s |\n", idx.Name, strings.Join(idx.Columns, ", "), yesNo(idx.Unique), idx.ValidationMsg)
+			}
+			if liveTable != nil {
+				for _, liveIdx := range liveTable.Indexes {
+					if !hasIndex(indexes, liveIdx.Name) && !liveIdx.Primary {
+						md.Appendf("| %s | %s | %s | (only in db) |\n", liveIdx.Name, strings.Join(liveIdx.Columns, ", "), yesNo(liveIdx.Unique))
+					}
+				}
+			}
+			md.Appendln()
+		}
+
+		if len(foreignKeys) > 0 || (liveTable != nil && len(liveTable.ForeignKeys) > 0) {
+			md.Appendln("### Foreign keys")
+			md.Appendln()
+			md.Appendln("| Column | References | |")
+			md.Appendln("|--------|------------|-|")
+			for _, fk := range foreignKeys {
+				note := ""
+				if fk.Inferred {
+					note = "inferred from name"
+				}
+				md.Appendf("| %s | %s.%s | %s |\n", fk.Column, fk.RefTable, fk.RefColumn, note)
+				diagram = append(diagram, "    "+fk.RefTable+" ||--o{ "+mi.table+" : \""+fk.Column+"\"")
+			}
+			if liveTable != nil {
+				for _, liveFk := range liveTable.ForeignKeys {
+					if !hasForeignKey(foreignKeys, liveFk.Column) {
+						md.Appendf("| %s | %s.%s | constraint %s (only in db) |\n", liveFk.Column, liveFk.RefTable, liveFk.RefColumn, liveFk.Name)
+						diagram = append(diagram, "    "+liveFk.RefTable+" ||--o{ "+mi.table+" : \""+liveFk.Column+"\"")
+					}
+				}
+			}
+			md.Appendln()
+		}
+	}
+
+	md.Appendln("## Diagram")
+	md.Appendln()
+	md.Appendln("```mermaid")
+	md.Appendln("erDiagram")
+	for _, line := range diagram {
+		md.Appendln(line)
+	}
+	md.Appendln("```")
+
+	return md.Bytes(), nil
+}
+
+var mermaidInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_\[\]]+`)
+
+func mermaidIdentifier(str string) string {
+	return strings.Trim(mermaidInvalidChars.ReplaceAllString(str, "_"), "_")
+}
+
+func mermaidKeys(keys []string) string {
+	if len(keys) == 0 {
+		return ""
+	}
+	return " " + strings.Join(keys, ", ")
+}
+
+func mdCode(str string) string {
+	if str == "" {
+		return ""
+	}
+	return "`" + str + "`"
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func modelHasColumn(columns []modelColumn, name string) bool {
+	for _, col := range columns {
+		if col.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasIndex(indexes []IndexInfo, name string) bool {
+	for _, idx := range indexes {
+		if idx.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasForeignKey(fks []modelForeignKey, column string) bool {
+	for _, fk := range fks {
+		if fk.Column == column {
+			return true
+		}
+	}
+	return false
+}
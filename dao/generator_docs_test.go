@@ -0,0 +1,29 @@
+package dao
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSchemaDocs(t *testing.T) {
+	t.Parallel()
+
+	c := context.Background()
+	d := New("1", "postgres", "", &generatorOrg{}, &generatorUser{})
+	d.SkipMigrations = true
+	// registered twice (as when the migrations run again), documented once
+	for n := 0; n < 2; n++ {
+		if err := d.AddUniqueIndex(c, "uix_generator_users_email", "Email already used", &generatorUser{}, "email"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.AddIndex(c, "ix_generator_users_org_id_age", "", &generatorUser{}, "org_id", "age"); err != nil {
+		t.Fatal(err)
+	}
+
+	md, err := d.SchemaDocs(c, SchemaDocsOptions{Title: "Test schema"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "schema_docs.md.golden", md)
+}
@@ -0,0 +1,159 @@
+package dao
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata")
+
+type generatorSettings struct {
+	Theme string
+}
+
+type generatorOrg struct {
+	BaseModel
+	Name string
+}
+
+type generatorUser struct {
+	BaseModel
+	OrgID     uuid.UUID
+	Email     string `gorm:"unique"`
+	LastLogin *time.Time
+	Settings  JSONB[generatorSettings]
+	Age       int
+}
+
+// assertGolden compares the output with testdata/<name>, run `go test -update` to regenerate it.
+func assertGolden(t *testing.T, name string, output []byte) {
+	t.Helper()
+	file := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.WriteFile(file, output, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(output, expected) {
+		t.Errorf("%s is outdated (run go test -update), got:\n%s", file, output)
+	}
+}
+
+func TestGenerateColumnsCode(t *testing.T) {
+	t.Parallel()
+
+	code, md, err := GenerateColumnsCode(GeneratorOptions{}, &generatorOrg{}, &generatorUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "columns.go.golden", code)
+	assertGolden(t, "columns.md.golden", md)
+
+	for n := 0; n < 5; n++ {
+		again, againMd, err := GenerateColumnsCode(GeneratorOptions{}, &generatorOrg{}, &generatorUser{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(code, again) || !bytes.Equal(md, againMd) {
+			t.Fatal("the generated output isn't deterministic")
+		}
+	}
+}
+
+const generatorModelsCode = `package appmodels
+
+import (
+	"time"
+
+	"github.com/coachbit/gorm-dao/dao"
+)
+
+type Settings struct {
+	Theme string
+}
+
+type User struct {
+	dao.BaseModel
+	Email     string
+	LastLogin *time.Time
+	Settings  dao.JSONB[Settings]
+	Tags      []string ` + "`gorm:\"-\"`" + `
+}
+`
+
+const generatorMainCode = `package main
+
+import (
+	"os"
+
+	"github.com/coachbit/gorm-dao/dao"
+	"%s"
+)
+
+func main() {
+	if err := dao.GenerateColumns(dao.GeneratorOptions{Package: "appmodels", TargetFile: os.Args[1]}, &appmodels.User{}); err != nil {
+		panic(err)
+	}
+}
+`
+
+// TestGeneratedColumnsCompile generates the columns of models in their own package, and builds it.
+func TestGeneratedColumnsCompile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs the go tool")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+
+	// inside the module, so that the generated package can import it
+	dir, err := os.MkdirTemp(".", "generated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	pkgDir := filepath.Join(dir, "appmodels")
+	mainDir := filepath.Join(dir, "generate")
+	for _, d := range []string{pkgDir, mainDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	importPath := "github.com/coachbit/gorm-dao/dao/" + filepath.Base(dir) + "/appmodels"
+	if err := os.WriteFile(filepath.Join(pkgDir, "models.go"), []byte(generatorModelsCode), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(mainDir, "main.go"), []byte(strings.Replace(generatorMainCode, "%s", importPath, 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := filepath.Abs(filepath.Join(pkgDir, "columns_generated.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"run", "./" + mainDir, target}, {"vet", "./" + pkgDir}} {
+		if out, err := exec.Command(goTool, args...).CombinedOutput(); err != nil {
+			t.Fatalf("go %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	code, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(code, []byte(`ColumnInfos.User.Settings = dao.Column{Table: "users", Name: "settings", GoType: "dao.JSONB[appmodels.Settings]"}`)) {
+		t.Errorf("expected package qualified go types:\n%s", code)
+	}
+}
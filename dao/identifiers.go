@@ -0,0 +1,89 @@
+package dao
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/ansel1/merry"
+)
+
+// identifierRegexp matches plain (unquoted) identifiers, optionally qualified (`email`, `users.email`)
+var identifierRegexp = regexp.MustCompile(`^[a-zA-Z_]\w*(\.[a-zA-Z_]\w*)?$`)
+
+// QuoteIdentifier quotes a (table, column, index...) name for use in sql.
+func QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteIdentifiers(names []string) string {
+	quoted := make([]string, len(names))
+	for n := range names {
+		quoted[n] = QuoteIdentifier(names[n])
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// validateIdentifiers checks names which are used unquoted in sql.
+func validateIdentifiers(names ...string) error {
+	for _, name := range names {
+		if !identifierRegexp.MatchString(name) {
+			return merry.New("invalid identifier").Appendf("%q", name)
+		}
+	}
+	return nil
+}
+
+// quoteColumn validates and quotes a (optionally qualified) column name. Unquoted identifiers are case insensitive in
+// postgres, so the names are lowercased to keep their meaning.
+func quoteColumn(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if err := validateIdentifiers(name); err != nil {
+		return "", err
+	}
+	parts := strings.Split(strings.ToLower(name), ".")
+	for n := range parts {
+		parts[n] = QuoteIdentifier(parts[n])
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// column is quoteColumn() for query builder methods, an invalid name is the query's error.
+func (q *Query) column(name string) string {
+	quoted, err := quoteColumn(name)
+	if err != nil {
+		q.err = firstErr(q.err, err)
+	}
+	return quoted
+}
+
+// columnWhitelist returns the columns of the registered models, both plain (`email`) and qualified (`users.email`).
+func (d *Dao) columnWhitelist() map[string]bool {
+	d.knownColumnsOnce.Do(func() {
+		d.knownColumns = map[string]bool{}
+		infos, err := d.modelInfos()
+		if err != nil {
+			return
+		}
+		for _, mi := range infos {
+			for _, field := range mi.fields {
+				d.knownColumns[field.DBName] = true
+				d.knownColumns[mi.table+"."+field.DBName] = true
+			}
+		}
+	})
+	return d.knownColumns
+}
+
+// KnownColumn checks if the (optionally qualified) column belongs to a registered model.
+func (d *Dao) KnownColumn(name string) bool {
+	return d.columnWhitelist()[strings.ToLower(name)]
+}
+
+func containsStringFold(strs []string, str string) bool {
+	for _, s := range strs {
+		if strings.EqualFold(s, str) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ansel1/merry"
+	utils "github.com/coachbit/gorm-dao/dao/daoutils"
+)
+
+const defaultSchema = "public"
+
+type DbColumn struct {
+	Name     string
+	DataType string
+	Nullable bool
+	Default  string
+}
+
+type DbIndex struct {
+	Name       string
+	Unique     bool
+	Primary    bool
+	Columns    []string
+	Definition string
+}
+
+type DbForeignKey struct {
+	Name      string
+	Column    string
+	RefTable  string
+	RefColumn string
+}
+
+type DbTable struct {
+	Name        string
+	Columns     []DbColumn
+	Indexes     []DbIndex
+	ForeignKeys []DbForeignKey
+}
+
+func (t DbTable) Column(name string) (DbColumn, bool) {
+	for _, col := range t.Columns {
+		if col.Name == name {
+			return col, true
+		}
+	}
+	return DbColumn{}, false
+}
+
+// DbSchema is the structure of a live (postgres) database schema.
+type DbSchema struct {
+	Schema string
+	Tables map[string]*DbTable
+}
+
+func (s DbSchema) TableNames() []string {
+	res := make([]string, 0, len(s.Tables))
+	for name := range s.Tables {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func (s *DbSchema) table(name string) *DbTable {
+	t, found := s.Tables[name]
+	if !found {
+		t = &DbTable{Name: name}
+		s.Tables[name] = t
+	}
+	return t
+}
+
+// IntrospectSchema loads tables, columns, indexes and foreign keys from information_schema and pg_indexes (empty
+// schema means "public").
+func (d *Dao) IntrospectSchema(c context.Context, schema string) (*DbSchema, error) {
+	if schema == "" {
+		schema = defaultSchema
+	}
+	res := &DbSchema{Schema: schema, Tables: map[string]*DbTable{}}
+	q := d.Query(c)
+
+	if err := introspectTables(q, res); err != nil {
+		return nil, err
+	}
+	if err := introspectColumns(q, res); err != nil {
+		return nil, err
+	}
+	if err := introspectIndexes(q, res); err != nil {
+		return nil, err
+	}
+	if err := introspectForeignKeys(q, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func introspectTables(q *Query, res *DbSchema) error {
+	rows, err := q.RawRows(`select table_name from information_schema.tables where table_schema = ? and table_type = 'BASE TABLE'`, res.Schema)
+	if err != nil {
+		return err
+	}
+	defer utils.CloseCloser(rows)
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return merry.Wrap(err)
+		}
+		res.table(table)
+	}
+	return merry.Wrap(rows.Err())
+}
+
+func introspectColumns(q *Query, res *DbSchema) error {
+	rows, err := q.RawRows(`select table_name, column_name, data_type, udt_name, coalesce(character_maximum_length, 0), is_nullable, coalesce(column_default, '')
+from information_schema.columns
+where table_schema = ?
+order by table_name, ordinal_position`, res.Schema)
+	if err != nil {
+		return err
+	}
+	defer utils.CloseCloser(rows)
+	for rows.Next() {
+		var table, nullable, udt string
+		var maxLen int
+		var col DbColumn
+		if err := rows.Scan(&table, &col.Name, &col.DataType, &udt, &maxLen, &nullable, &col.Default); err != nil {
+			return merry.Wrap(err)
+		}
+		switch col.DataType {
+		case "USER-DEFINED":
+			col.DataType = udt
+		case "ARRAY":
+			col.DataType = strings.TrimPrefix(udt, "_") + "[]"
+		}
+		if maxLen > 0 {
+			col.DataType = fmt.Sprintf("%s(%d)", col.DataType, maxLen)
+		}
+		col.Nullable = nullable == "YES"
+		if t, found := res.Tables[table]; found {
+			t.Columns = append(t.Columns, col)
+		}
+	}
+	return merry.Wrap(rows.Err())
+}
+
+var indexColumnsRegexp = regexp.MustCompile(`(?i)\busing\s+\w+\s*\((.*)\)`)
+
+func introspectIndexes(q *Query, res *DbSchema) error {
+	rows, err := q.RawRows(`select i.tablename, i.indexname, i.indexdef, coalesce(c.contype = 'p', false)
+from pg_indexes i
+left join pg_constraint c on c.conname = i.indexname and c.connamespace = (select oid from pg_namespace where nspname = i.schemaname)
+where i.schemaname = ?
+order by i.tablename, i.indexname`, res.Schema)
+	if err != nil {
+		return err
+	}
+	defer utils.CloseCloser(rows)
+	for rows.Next() {
+		var table string
+		var idx DbIndex
+		if err := rows.Scan(&table, &idx.Name, &idx.Definition, &idx.Primary); err != nil {
+			return merry.Wrap(err)
+		}
+		idx.Unique = strings.HasPrefix(strings.ToUpper(idx.Definition), "CREATE UNIQUE")
+		if match := indexColumnsRegexp.FindStringSubmatch(idx.Definition); len(match) > 1 {
+			for _, col := range strings.Split(match[1], ",") {
+				// without the operator class or ordering (`name gin_trgm_ops`, `created_at DESC`)
+				if fields := strings.Fields(col); len(fields) > 0 {
+					idx.Columns = append(idx.Columns, strings.Trim(fields[0], `"`))
+				}
+			}
+		}
+		if t, found := res.Tables[table]; found {
+			t.Indexes = append(t.Indexes, idx)
+		}
+	}
+	return merry.Wrap(rows.Err())
+}
+
+func introspectForeignKeys(q *Query, res *DbSchema) error {
+	rows, err := q.RawRows(`select tc.table_name, tc.constraint_name, kcu.column_name, ccu.table_name, ccu.column_name
+from information_schema.table_constraints tc
+join information_schema.key_column_usage kcu on tc.constraint_name = kcu.constraint_name and tc.table_schema = kcu.table_schema
+join information_schema.constraint_column_usage ccu on ccu.constraint_name = tc.constraint_name and ccu.table_schema = tc.table_schema
+where tc.constraint_type = 'FOREIGN KEY' and tc.table_schema = ?
+order by tc.table_name, tc.constraint_name`, res.Schema)
+	if err != nil {
+		return err
+	}
+	defer utils.CloseCloser(rows)
+	for rows.Next() {
+		var table string
+		var fk DbForeignKey
+		if err := rows.Scan(&table, &fk.Name, &fk.Column, &fk.RefTable, &fk.RefColumn); err != nil {
+			return merry.Wrap(err)
+		}
+		if t, found := res.Tables[table]; found {
+			t.ForeignKeys = append(t.ForeignKeys, fk)
+		}
+	}
+	return merry.Wrap(rows.Err())
+}
@@ -0,0 +1,157 @@
+package dao
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/ansel1/merry"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// JSONB is a model field stored in a jsonb column, for example `Settings dao.JSONB[UserSettings]`. NULL is scanned as
+// the zero value of T.
+type JSONB[T any] struct {
+	Data T
+}
+
+func NewJSONB[T any](data T) JSONB[T] {
+	return JSONB[T]{Data: data}
+}
+
+// GormDataType is used by gorm (auto migrations) and by the schema generators.
+func (j JSONB[T]) GormDataType(gorm.Dialect) string {
+	return "jsonb"
+}
+
+func (j JSONB[T]) Value() (driver.Value, error) {
+	byts, err := json.Marshal(j.Data)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return string(byts), nil
+}
+
+func (j *JSONB[T]) Scan(src interface{}) error {
+	var byts []byte
+	switch v := src.(type) {
+	case nil:
+		var zero T
+		j.Data = zero
+		return nil
+	case []byte:
+		byts = v
+	case string:
+		byts = []byte(v)
+	default:
+		return merry.New("invalid jsonb value").Appendf("%T", src)
+	}
+	return merry.Wrap(json.Unmarshal(byts, &j.Data))
+}
+
+func (j JSONB[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(j.Data)
+}
+
+func (j *JSONB[T]) UnmarshalJSON(byts []byte) error {
+	return json.Unmarshal(byts, &j.Data)
+}
+
+// jsonPath splits dotted paths (`notifications.email`, `items.0.name`) into a postgres text[] value
+func jsonPath(path string) interface{} {
+	return pq.Array(strings.Split(path, "."))
+}
+
+// FilterJSONPath compares the value at the (dotted) path of a jsonb column, for example
+// `FilterJSONPath("settings", "notifications.email", "=", true)`. Numeric and boolean values are compared as such,
+// everything else as text.
+func (q *Query) FilterJSONPath(column, path, operator string, value interface{}) *Query {
+	op := strings.ToLower(strings.TrimSpace(operator))
+	if !filterOperators[op] {
+		q.err = merry.New("invalid json path operator").Appendf("operator: %s", operator)
+		return q
+	}
+	expr := q.column(column) + " #>> ?::text[]"
+	switch reflect.Indirect(reflect.ValueOf(value)).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		expr = "(" + expr + ")::numeric"
+	case reflect.Bool:
+		expr = "(" + expr + ")::boolean"
+	}
+	q.appendFilterExpressionAndValues("filter-json", expr+" "+op+" ?", jsonPath(path), value)
+	return q
+}
+
+// FilterJSONContains filters rows where the jsonb column contains the (json marshalled) value (`@>`).
+func (q *Query) FilterJSONContains(column string, value interface{}) *Query {
+	byts, err := json.Marshal(value)
+	if err != nil {
+		q.err = merry.Wrap(err).Appendf("marshalling json filter for %s", column)
+		return q
+	}
+	q.appendFilterExpressionAndValues("filter-json-contains", q.column(column)+" @> ?::jsonb", string(byts))
+	return q
+}
+
+// FilterJSONHasKey filters rows where the jsonb column (an object) has the top level key. It's the `?` operator, but
+// `?` is a placeholder here, so jsonb_exists() is used.
+func (q *Query) FilterJSONHasKey(column, key string) *Query {
+	q.appendFilterExpressionAndValues("filter-json-key", "jsonb_exists("+q.column(column)+", ?)", key)
+	return q
+}
+
+type jsonSet struct {
+	path  string
+	value interface{}
+}
+
+// JSONPatch is a partial update of a jsonb column with UpdateColumnValues, only the given paths are changed:
+//
+//	d.UpdateColumnValues(c, user, map[string]interface{}{"settings": dao.JSONSet("theme", "dark").Set("notifications.email", false)})
+//
+// Note that the model's field is not updated, reload the model if needed.
+type JSONPatch []jsonSet
+
+// JSONSet creates a JSONPatch setting the value at the (dotted) path.
+func JSONSet(path string, value interface{}) JSONPatch {
+	return JSONPatch{{path: path, value: value}}
+}
+
+func (p JSONPatch) Set(path string, value interface{}) JSONPatch {
+	return append(p, jsonSet{path: path, value: value})
+}
+
+// expr renders nested jsonb_set() calls, missing objects are created only for the last path element (as in postgres).
+func (p JSONPatch) expr(column string) (*gorm.SqlExpr, error) {
+	sql := "coalesce(" + QuoteIdentifier(column) + ", '{}'::jsonb)"
+	var values []interface{}
+	for _, set := range p {
+		byts, err := json.Marshal(set.value)
+		if err != nil {
+			return nil, merry.Wrap(err).Appendf("marshalling %s.%s", column, set.path)
+		}
+		sql = "jsonb_set(" + sql + ", ?::text[], ?::jsonb, true)"
+		values = append(values, jsonPath(set.path), string(byts))
+	}
+	return gorm.Expr(sql, values...), nil
+}
+
+// jsonPatchExprs replaces JSONPatch values with sql expressions (the original map is not changed).
+func jsonPatchExprs(cols map[string]interface{}) (map[string]interface{}, error) {
+	res := make(map[string]interface{}, len(cols))
+	for col, val := range cols {
+		if patch, is := val.(JSONPatch); is {
+			expr, err := patch.expr(col)
+			if err != nil {
+				return nil, err
+			}
+			val = expr
+		}
+		res[col] = val
+	}
+	return res, nil
+}
@@ -0,0 +1,147 @@
+package dao
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// modelColumn is a column as defined by the gorm model (not necessarily the same as in the database).
+type modelColumn struct {
+	Name     string
+	GoField  string
+	GoType   string
+	SQLType  string
+	Nullable bool
+	Default  string
+	Primary  bool
+	Unique   bool
+}
+
+type modelForeignKey struct {
+	Column    string
+	RefTable  string
+	RefColumn string
+	// Inferred is true for keys found by naming convention (`org_id` referencing `orgs`), not by gorm associations
+	Inferred bool
+}
+
+func modelColumns(db *gorm.DB, mi *modelInfo) []modelColumn {
+	var res []modelColumn
+	for _, field := range mi.fields {
+		_, notNull := field.TagSettingsGet("NOT NULL")
+		_, unique := field.TagSettingsGet("UNIQUE")
+		dflt, _ := field.TagSettingsGet("DEFAULT")
+		res = append(res, modelColumn{
+			Name:     field.DBName,
+			GoField:  field.Name,
+			GoType:   goTypeName(field.Struct.Type),
+			SQLType:  sqlTypeOf(db, field),
+			Nullable: !notNull && !field.IsPrimaryKey,
+			Default:  dflt,
+			Primary:  field.IsPrimaryKey,
+			Unique:   unique,
+		})
+	}
+	return res
+}
+
+// sqlTypeOf returns the sql type used by gorm's AutoMigrate (without constraints like NOT NULL or DEFAULT).
+func sqlTypeOf(db *gorm.DB, field *gorm.StructField) (res string) {
+	defer func() {
+		if r := recover(); r != nil {
+			res = "?"
+		}
+	}()
+	_, _, _, additional := gorm.ParseFieldStructForDialect(field, db.Dialect())
+	res = db.Dialect().DataTypeOf(field)
+	return strings.TrimSpace(strings.TrimSuffix(res, additional))
+}
+
+// modelTagIndexes returns indexes defined with `index` and `unique_index` tags (named like gorm's AutoMigrate does).
+func modelTagIndexes(mi *modelInfo) []IndexInfo {
+	byName := map[string]*IndexInfo{}
+	var names []string
+	for _, field := range mi.fields {
+		for _, setting := range []string{"INDEX", "UNIQUE_INDEX"} {
+			value, found := field.TagSettingsGet(setting)
+			if !found {
+				continue
+			}
+			unique := setting == "UNIQUE_INDEX"
+			for _, name := range strings.Split(value, ",") {
+				if name == "" || name == setting {
+					prefix := "idx"
+					if unique {
+						prefix = "uix"
+					}
+					name = fmt.Sprintf("%s_%s_%s", prefix, mi.table, field.DBName)
+				}
+				idx, found := byName[name]
+				if !found {
+					idx = &IndexInfo{Name: name, Table: mi.table, Unique: unique}
+					byName[name] = idx
+					names = append(names, name)
+				}
+				idx.Columns = append(idx.Columns, field.DBName)
+			}
+		}
+	}
+	res := make([]IndexInfo, 0, len(names))
+	for _, name := range names {
+		res = append(res, *byName[name])
+	}
+	return res
+}
+
+// modelIndexes returns the tag indexes and indexes registered with AddIndex/AddUniqueIndex for a table.
+func (d *Dao) modelIndexes(mi *modelInfo) []IndexInfo {
+	res := modelTagIndexes(mi)
+	for _, idx := range d.indexes {
+		if idx.Table == mi.table {
+			res = append(res, idx)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+func modelForeignKeys(db *gorm.DB, mi *modelInfo, all []*modelInfo) []modelForeignKey {
+	var res []modelForeignKey
+	explicit := map[string]bool{}
+	for _, field := range mi.relationships {
+		rel := field.Relationship
+		if rel.Kind != "belongs_to" {
+			continue
+		}
+		ty := field.Struct.Type
+		for ty.Kind() == reflect.Ptr || ty.Kind() == reflect.Slice {
+			ty = ty.Elem()
+		}
+		refTable := db.NewScope(reflect.New(ty).Interface()).TableName()
+		for n := range rel.ForeignDBNames {
+			refColumn := "id"
+			if n < len(rel.AssociationForeignDBNames) {
+				refColumn = rel.AssociationForeignDBNames[n]
+			}
+			res = append(res, modelForeignKey{Column: rel.ForeignDBNames[n], RefTable: refTable, RefColumn: refColumn})
+			explicit[rel.ForeignDBNames[n]] = true
+		}
+	}
+	for _, field := range mi.fields {
+		if explicit[field.DBName] || field.IsPrimaryKey || !strings.HasSuffix(field.DBName, "_id") {
+			continue
+		}
+		prefix := strings.TrimSuffix(field.DBName, "_id")
+		for _, other := range all {
+			if gorm.ToDBName(other.name) == prefix {
+				res = append(res, modelForeignKey{Column: field.DBName, RefTable: other.table, RefColumn: "id", Inferred: true})
+				break
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,307 @@
+package dao
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/ansel1/merry"
+	"github.com/jinzhu/gorm"
+)
+
+// NamedParams can be used for named expression params, structs (or pointers to structs) work too, their fields are
+// bound by field name and by column name (i.e. both `:CreatedAt` and `:created_at`).
+type NamedParams map[string]interface{}
+
+// FilterNamedExpression is FilterRawExpression with `:name` or `@name` parameters. Slice values are expanded, so they
+// can be used in `in (:ids)`.
+func (q *Query) FilterNamedExpression(expression string, params interface{}) *Query {
+	expr, values, err := bindNamedParams(expression, params)
+	if err != nil {
+		q.err = firstErr(q.err, err)
+		return q
+	}
+	return q.FilterRawExpression(expr, values...)
+}
+
+// OrderByNamedExpression is OrderByRawExpression with named parameters (see FilterNamedExpression).
+func (q *Query) OrderByNamedExpression(expression string, params interface{}) *Query {
+	expr, values, err := bindNamedParams(expression, params)
+	if err != nil {
+		q.err = firstErr(q.err, err)
+		return q
+	}
+	return q.OrderByRawExpression(expr, values...)
+}
+
+// RawRowsNamed is RawRows with named parameters (see FilterNamedExpression).
+func (q *Query) RawRowsNamed(sql string, params interface{}) (*sql.Rows, error) {
+	expr, values, err := bindNamedParams(sql, params)
+	if err != nil {
+		return nil, err
+	}
+	return q.RawRows(expr, values...)
+}
+
+// bindNamedParams replaces named parameters with positional placeholders. String literals (also `E'...'` and
+// `$tag$...$tag$`), quoted identifiers, casts (`::text`) and operators like `@>`, `<@` or `@@` are left untouched,
+// comments are removed. The only `?` in the result are the placeholders (see escapeSQLLiteral), so that it can be
+// passed on to FilterRawExpression() and gorm.
+func bindNamedParams(expression string, params interface{}) (string, []interface{}, error) {
+	lookup, err := namedParamsLookup(params)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var res strings.Builder
+	var values []interface{}
+	for i := 0; i < len(expression); i++ {
+		end, err := skipSQLLiteral(expression, i)
+		if err != nil {
+			return "", nil, err
+		}
+		if end > i {
+			res.WriteString(escapeSQLLiteral(expression[i:end]))
+			i = end - 1
+			continue
+		}
+		ch := expression[i]
+		switch {
+		case ch == '?':
+			return "", nil, merry.New("positional placeholder in named expression").Appendf("expression: %s", expression)
+		case (ch == ':' || ch == '@') && isNamedParamStart(expression, i):
+			end := i + 1
+			for end < len(expression) && isNameChar(expression[end]) {
+				end++
+			}
+			name := expression[i+1 : end]
+			val, found := lookup(name)
+			if !found {
+				return "", nil, merry.New("unbound named parameter").Appendf("%s in %s", name, expression)
+			}
+			placeholders, vals := expandNamedValue(val)
+			res.WriteString(placeholders)
+			values = append(values, vals...)
+			i = end - 1
+			continue
+		}
+		res.WriteByte(ch)
+	}
+	return res.String(), values, nil
+}
+
+// dollarQuoteRegexp matches the opening of dollar quoted strings (`$$` or `$tag$`, but not `$1`)
+var dollarQuoteRegexp = regexp.MustCompile(`^\$([a-zA-Z_][a-zA-Z_0-9]*)?\$`)
+
+// skipSQLLiteral returns the end of the string literal, quoted identifier or comment starting at i, or i if there is
+// none.
+func skipSQLLiteral(expression string, i int) (int, error) {
+	rest := expression[i:]
+	switch {
+	case strings.HasPrefix(rest, "--"):
+		if end := strings.IndexByte(rest, '\n'); end >= 0 {
+			return i + end + 1, nil
+		}
+		return len(expression), nil
+	case strings.HasPrefix(rest, "/*"):
+		// block comments nest in postgres
+		depth := 0
+		for j := i; j+1 < len(expression); j++ {
+			switch expression[j : j+2] {
+			case "/*":
+				depth++
+				j++
+			case "*/":
+				depth--
+				j++
+				if depth == 0 {
+					return j + 1, nil
+				}
+			}
+		}
+		return 0, merry.New("unterminated comment").Appendf("expression: %s", expression)
+	case rest[0] == '\'' || rest[0] == '"':
+		return skipQuoted(expression, i, rest[0], false)
+	case (rest[0] == 'e' || rest[0] == 'E') && len(rest) > 1 && rest[1] == '\'' && (i == 0 || !isNameChar(expression[i-1])):
+		return skipQuoted(expression, i+1, '\'', true)
+	case rest[0] == '$' && (i == 0 || !isNameChar(expression[i-1])):
+		if tag := dollarQuoteRegexp.FindString(rest); tag != "" {
+			end := strings.Index(rest[len(tag):], tag)
+			if end < 0 {
+				return 0, merry.New("unterminated dollar quote").Appendf("expression: %s", expression)
+			}
+			return i + len(tag) + end + len(tag), nil
+		}
+	}
+	return i, nil
+}
+
+// skipQuoted returns the end of the quoted string starting at i, doubled quotes (and backslash escapes in `E'...'`
+// strings) don't end it.
+func skipQuoted(expression string, i int, quote byte, backslashEscapes bool) (int, error) {
+	for j := i + 1; j < len(expression); j++ {
+		switch {
+		case backslashEscapes && expression[j] == '\\':
+			j++
+		case expression[j] == quote:
+			if j+1 < len(expression) && expression[j+1] == quote {
+				j++
+				continue
+			}
+			return j + 1, nil
+		}
+	}
+	return 0, merry.New("unterminated quote").Appendf("expression: %s", expression)
+}
+
+// escapeSQLLiteral removes comments (a line comment would hide the rest of the query the expression is part of) and
+// rewrites literals and quoted identifiers containing `?` with unicode escapes, because gorm binds every `?`.
+func escapeSQLLiteral(literal string) string {
+	if strings.HasPrefix(literal, "--") || strings.HasPrefix(literal, "/*") {
+		return " "
+	}
+	if !strings.Contains(literal, "?") {
+		return literal
+	}
+	switch literal[0] {
+	case 'e', 'E':
+		var res strings.Builder
+		for i := 0; i < len(literal); i++ {
+			switch {
+			case literal[i] == '?':
+				res.WriteString(`\x3F`)
+			case literal[i] == '\\' && i+1 < len(literal) && literal[i+1] == '?':
+				res.WriteString(`\x3F`)
+				i++
+			case literal[i] == '\\' && i+1 < len(literal):
+				res.WriteString(literal[i : i+2])
+				i++
+			default:
+				res.WriteByte(literal[i])
+			}
+		}
+		return res.String()
+	case '$':
+		tag := dollarQuoteRegexp.FindString(literal)
+		inner := strings.ReplaceAll(literal[len(tag):len(literal)-len(tag)], "'", "''")
+		return unicodeEscaped('\'', inner)
+	}
+	return unicodeEscaped(literal[0], literal[1:len(literal)-1])
+}
+
+// unicodeEscaped quotes the (already quote-escaped) string as a `U&'...'` literal or `U&"..."` identifier, with `?`
+// escaped.
+func unicodeEscaped(quote byte, inner string) string {
+	inner = strings.NewReplacer(`\`, `\\`, "?", `\003F`).Replace(inner)
+	return "U&" + string(quote) + inner + string(quote)
+}
+
+func isNamedParamStart(expression string, i int) bool {
+	if i+1 >= len(expression) || !isNameChar(expression[i+1]) || (expression[i+1] >= '0' && expression[i+1] <= '9') {
+		return false
+	}
+	if i > 0 {
+		switch expression[i-1] {
+		case ':', '@', '<':
+			return false
+		}
+		// `array[1:n]` slices and `a@b` aren't params
+		if isNameChar(expression[i-1]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isNameChar(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+}
+
+// emptyListSQL is an empty slice's expansion, a subquery without rows, so that `in (:ids)` matches nothing and
+// `not in (:ids)` matches everything
+const emptyListSQL = "select null where false"
+
+// expandNamedValue expands slices to `?,?,?` (empty slices to emptyListSQL).
+func expandNamedValue(val interface{}) (string, []interface{}) {
+	if _, isValuer := val.(driver.Valuer); isValuer || val == nil {
+		return "?", []interface{}{val}
+	}
+	if _, isBytes := val.([]byte); isBytes {
+		return "?", []interface{}{val}
+	}
+	v := reflect.ValueOf(val)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "?", []interface{}{val}
+	}
+	if v.Len() == 0 {
+		return emptyListSQL, nil
+	}
+	values := make([]interface{}, v.Len())
+	for n := range values {
+		values[n] = v.Index(n).Interface()
+	}
+	return strings.TrimSuffix(strings.Repeat("?,", len(values)), ","), values
+}
+
+func namedParamsLookup(params interface{}) (func(name string) (interface{}, bool), error) {
+	switch p := params.(type) {
+	case nil:
+		return func(string) (interface{}, bool) { return nil, false }, nil
+	case NamedParams:
+		return func(name string) (interface{}, bool) { val, found := p[name]; return val, found }, nil
+	case map[string]interface{}:
+		return func(name string) (interface{}, bool) { val, found := p[name]; return val, found }, nil
+	}
+
+	v := reflect.ValueOf(params)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, merry.New("invalid named params").Appendf("expected map or struct, found %T", params)
+	}
+	fields := map[string]reflect.Value{}
+	addNamedParamFields(v, fields)
+	return func(name string) (interface{}, bool) {
+		val, found := fields[name]
+		if !found {
+			return nil, false
+		}
+		return val.Interface(), true
+	}, nil
+}
+
+// addNamedParamFields indexes the struct's fields, embedded structs (like BaseModel) are flattened as in gorm. Outer
+// fields take precedence over the embedded ones.
+func addNamedParamFields(v reflect.Value, fields map[string]reflect.Value) {
+	var embedded []reflect.Value
+	for n := 0; n < v.NumField(); n++ {
+		field := v.Type().Field(n)
+		if field.PkgPath != "" {
+			continue
+		}
+		fieldValue := v.Field(n)
+		if field.Anonymous {
+			for fieldValue.Kind() == reflect.Ptr && !fieldValue.IsNil() {
+				fieldValue = fieldValue.Elem()
+			}
+			if fieldValue.Kind() == reflect.Struct {
+				embedded = append(embedded, fieldValue)
+				continue
+			}
+		}
+		fields[field.Name] = fieldValue
+		fields[gorm.ToColumnName(field.Name)] = fieldValue
+	}
+	for _, e := range embedded {
+		inner := map[string]reflect.Value{}
+		addNamedParamFields(e, inner)
+		for name, val := range inner {
+			if _, found := fields[name]; !found {
+				fields[name] = val
+			}
+		}
+	}
+}
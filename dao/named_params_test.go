@@ -0,0 +1,142 @@
+package dao
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ansel1/merry"
+	"github.com/gofrs/uuid"
+)
+
+type namedParamsModel struct {
+	BaseModel
+	Email string
+}
+
+func TestBindNamedParams(t *testing.T) {
+	t.Parallel()
+
+	id := uuid.Must(uuid.NewV4())
+	params := NamedParams{"id": 1, "name": "x", "ids": []int{1, 2}, "none": []int{}}
+	for _, tc := range []struct {
+		name       string
+		expression string
+		params     interface{}
+		sql        string
+		values     []interface{}
+		err        bool
+	}{
+		{name: "colon", expression: "id = :id", params: params, sql: "id = ?", values: []interface{}{1}},
+		{name: "at", expression: "id = @id and name = @name", params: params, sql: "id = ? and name = ?", values: []interface{}{1, "x"}},
+		{name: "slice", expression: "id in (:ids)", params: params, sql: "id in (?,?)", values: []interface{}{1, 2}},
+		{name: "empty slice", expression: "id not in (:none)", params: params, sql: "id not in (select null where false)"},
+		{name: "cast", expression: "id::text = :name", params: params, sql: "id::text = ?", values: []interface{}{"x"}},
+		{name: "operators", expression: "tags @> :name and tags <@ :name and v @@ q", params: params, sql: "tags @> ? and tags <@ ? and v @@ q", values: []interface{}{"x", "x"}},
+		{name: "array slice", expression: "arr[1:2]", params: params, sql: "arr[1:2]"},
+		{name: "string literal", expression: "name = ':id?' and id = :id", params: params, sql: `name = U&':id\003F' and id = ?`, values: []interface{}{1}},
+		{name: "doubled quote", expression: "name = 'it''s :id' and id = :id", params: params, sql: "name = 'it''s :id' and id = ?", values: []interface{}{1}},
+		{name: "quoted identifier", expression: `":id" = :id`, params: params, sql: `":id" = ?`, values: []interface{}{1}},
+		{name: "escape string", expression: `name = E'\':id?' and id = :id`, params: params, sql: `name = E'\':id\x3F' and id = ?`, values: []interface{}{1}},
+		{name: "line comment", expression: "id = :id -- :name?\nand 1 = 1", params: params, sql: "id = ?  and 1 = 1", values: []interface{}{1}},
+		{name: "trailing line comment", expression: "id = :id -- :name?", params: params, sql: "id = ?  ", values: []interface{}{1}},
+		{name: "block comment", expression: "id = /* :name? /* nested :x */ ? */ :id", params: params, sql: "id =   ?", values: []interface{}{1}},
+		{name: "dollar quote", expression: "name = $$:name?$$ and id = :id", params: params, sql: `name = U&':name\003F' and id = ?`, values: []interface{}{1}},
+		{name: "escaped question mark", expression: `name = E'\\\?' and id = :id`, params: params, sql: `name = E'\\\x3F' and id = ?`, values: []interface{}{1}},
+		{name: "quoted identifier with question mark", expression: `"a\?" = :id`, params: params, sql: `U&"a\\\003F" = ?`, values: []interface{}{1}},
+		{name: "dollar quote with quotes", expression: "name = $$it's?$$", params: params, sql: `name = U&'it''s\003F'`},
+		{name: "tagged dollar quote", expression: "name = $t$ $$ :name? $t$ and id = :id", params: params, sql: `name = U&' $$ :name\003F ' and id = ?`, values: []interface{}{1}},
+		{name: "struct", expression: "email = :email and id = :ID", params: namedParamsModel{BaseModel: BaseModel{ID: id}, Email: "e"}, sql: "email = ? and id = ?", values: []interface{}{"e", id}},
+		{name: "embedded field", expression: "id = :id", params: &namedParamsModel{BaseModel: BaseModel{ID: id}}, sql: "id = ?", values: []interface{}{id}},
+		{name: "unbound", expression: "id = :nope", params: params, err: true},
+		{name: "positional", expression: "id = ?", params: params, err: true},
+		{name: "unterminated quote", expression: "name = 'x", params: params, err: true},
+		{name: "unterminated comment", expression: "id = 1 /* x", params: params, err: true},
+		{name: "unterminated dollar quote", expression: "name = $x$ abc", params: params, err: true},
+		{name: "invalid params", expression: "id = :id", params: 1, err: true},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			sql, values, err := bindNamedParams(tc.expression, tc.params)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error, got %q %#v", sql, values)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != tc.sql {
+				t.Errorf("sql: expected %q, got %q", tc.sql, sql)
+			}
+			if len(values) != 0 || len(tc.values) != 0 {
+				if !reflect.DeepEqual(values, tc.values) {
+					t.Errorf("values: expected %#v, got %#v", tc.values, values)
+				}
+			}
+		})
+	}
+}
+
+func TestNamedExpressionQuery(t *testing.T) {
+	t.Parallel()
+
+	d := New("1", "postgres", "", &namedParamsModel{})
+	params := NamedParams{"email": "e", "ids": []int{1, 2}}
+	for _, tc := range []struct {
+		name   string
+		query  func(q *Query) *Query
+		sql    string
+		values []interface{}
+	}{
+		{
+			name:   "literal question mark",
+			query:  func(q *Query) *Query { return q.FilterNamedExpression("email <> 'a?' and email = :email", params) },
+			sql:    `SELECT * FROM "named_params_models"  WHERE ( (email <> U&'a\003F' and email = $1) ) LIMIT 50`,
+			values: []interface{}{"e"},
+		},
+		{
+			name:   "line comment",
+			query:  func(q *Query) *Query { return q.FilterNamedExpression("email = :email -- why?", params) },
+			sql:    `SELECT * FROM "named_params_models"  WHERE ( (email = $1  ) ) LIMIT 50`,
+			values: []interface{}{"e"},
+		},
+		{
+			name: "order by",
+			query: func(q *Query) *Query {
+				return q.FilterNamedExpression("id::text in (:ids)", params).OrderByNamedExpression("email = :email /* ? */ desc", params)
+			},
+			sql:    `SELECT * FROM "named_params_models"  WHERE ( (id::text in ($1,$2)) ) ORDER BY email = $3   desc LIMIT 50`,
+			values: []interface{}{1, 2, "e"},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			sql, values, err := tc.query(d.Query(context.Background())).ToSQL(&namedParamsModel{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != tc.sql {
+				t.Errorf("sql: expected\n%s\ngot\n%s", tc.sql, sql)
+			}
+			if !reflect.DeepEqual(values, tc.values) {
+				t.Errorf("values: expected %#v, got %#v", tc.values, values)
+			}
+		})
+	}
+}
+
+func TestNamedExpressionKeepsFirstError(t *testing.T) {
+	t.Parallel()
+
+	d := New("1", "postgres", "", &namedParamsModel{})
+	first := merry.New("first")
+	q := d.Query(context.Background())
+	q.err = first
+	if err := q.FilterNamedExpression("id = :nope", nil).OrderByNamedExpression("'x", nil).err; err != first {
+		t.Errorf("expected the first error, got %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package dao
+
+import (
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/ansel1/merry"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	offlineDriverName = "gorm-dao-offline"
+	defaultDialect    = "postgres"
+)
+
+// ErrOffline is returned by every statement executed on an offline db.
+var ErrOffline = merry.New("offline db, statements can't be executed")
+
+func init() {
+	sql.Register(offlineDriverName, offlineDriver{})
+}
+
+type offlineDriver struct{}
+
+func (offlineDriver) Open(name string) (driver.Conn, error) { return offlineConn{}, nil }
+
+type offlineConn struct{}
+
+func (offlineConn) Prepare(query string) (driver.Stmt, error) { return nil, ErrOffline }
+func (offlineConn) Close() error                              { return nil }
+func (offlineConn) Begin() (driver.Tx, error)                 { return nil, ErrOffline }
+
+// offlineGormDb is a gorm db without a database connection, it can be used for gorm model metadata (table names,
+// columns, sql types) and sql rendering.
+func offlineGormDb(dialect string) (*gorm.DB, error) {
+	if dialect == "" {
+		dialect = defaultDialect
+	}
+	sqlDb, err := sql.Open(offlineDriverName, "")
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	db, err := gorm.Open(dialect, sqlDb)
+	if err != nil {
+		return nil, merry.Wrap(err).Appendf("dialect %s", dialect)
+	}
+	db.LogMode(false)
+	return db, nil
+}
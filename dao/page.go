@@ -0,0 +1,190 @@
+package dao
+
+import (
+	"database/sql"
+	"reflect"
+
+	"github.com/ansel1/merry"
+	"golang.org/x/sync/errgroup"
+)
+
+// PageTotal is how Page() computes the total number of rows.
+type PageTotal int
+
+const (
+	// PageTotalNone doesn't compute the total
+	PageTotalNone PageTotal = iota
+	// PageTotalExact counts the rows with Count()
+	PageTotalExact
+	// PageTotalEstimated uses the table statistics (pg_class.reltuples) for unfiltered queries, or the planner's
+	// estimate, it's cheap but can be way off
+	PageTotalEstimated
+	// PageTotalAuto estimates the total, and counts exactly if the estimate is below pageTotalExactMaxRows
+	PageTotalAuto
+)
+
+// PageTotalAuto counts the rows exactly if there are (estimated) fewer, counting is cheap enough there and estimates of
+// small or filtered tables tend to be the most off
+const pageTotalExactMaxRows = 10_000
+
+// PageInfo is the page metadata returned by Query.Page(), see also LoadPage().
+type PageInfo struct {
+	// Page is zero based
+	Page     int  `json:"page"`
+	PageSize int  `json:"page_size"`
+	HasNext  bool `json:"has_next"`
+	// Total and Pages are nil if the total isn't computed (see WithTotal())
+	Total          *int `json:"total,omitempty"`
+	Pages          *int `json:"pages,omitempty"`
+	TotalEstimated bool `json:"total_estimated,omitempty"`
+}
+
+// Page is a page of items with its metadata, the JSON response of list endpoints:
+//
+//	{"items": [...], "page": 2, "page_size": 20, "has_next": true, "total": 245, "pages": 13}
+type Page[T any] struct {
+	Items []T `json:"items"`
+	PageInfo
+}
+
+// LoadPage is Query.Page() returning the items with the metadata, T is a model or a pointer to a model. Items are an
+// empty slice (not nil) if there are none.
+func LoadPage[T any](q *Query) (Page[T], error) {
+	items := []T{}
+	info, err := q.Page(&items)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	return Page[T]{Items: items, PageInfo: info}, nil
+}
+
+// WithTotal sets how Page() computes the total.
+func (q *Query) WithTotal(total PageTotal) *Query {
+	q.pageTotal = total
+	return q
+}
+
+// Page loads the page into target (a pointer to a slice of models) and returns the page metadata. HasNext is known by
+// loading one row more than the page size, the total (see WithTotal()) is computed concurrently with the page if the
+// query isn't in a transaction.
+func (q *Query) Page(target interface{}) (PageInfo, error) {
+	if q.err != nil {
+		return PageInfo{}, q.err
+	}
+	sample, err := sliceSample(target)
+	if err != nil {
+		return PageInfo{}, err
+	}
+	if q.pageSize == 0 {
+		q.pageSize = defaultPageSize
+	}
+	info := PageInfo{Page: q.pageNo, PageSize: q.pageSize}
+
+	// copies, so that the queries don't share their log strings and paging
+	items, totals := *q, *q
+	items.logStr = append([]string(nil), q.logStr...)
+	items.lookahead = 1
+	totals.logStr = append([]string(nil), q.logStr...)
+
+	var total int
+	loadTotal := func() (err error) {
+		total, info.TotalEstimated, err = totals.total(sample)
+		return err
+	}
+
+	if _, isTx := q.gormDb.CommonDB().(*sql.Tx); isTx || q.pageTotal == PageTotalNone {
+		if err := items.All(target); err != nil {
+			return PageInfo{}, err
+		}
+		if q.pageTotal != PageTotalNone {
+			if err := loadTotal(); err != nil {
+				return PageInfo{}, err
+			}
+		}
+	} else {
+		var grp errgroup.Group
+		grp.Go(func() error { return items.All(target) })
+		grp.Go(loadTotal)
+		if err := grp.Wait(); err != nil {
+			return PageInfo{}, err
+		}
+	}
+
+	slice := reflect.ValueOf(target).Elem()
+	if slice.Len() > q.pageSize {
+		info.HasNext = true
+		slice.Set(slice.Slice(0, q.pageSize))
+	}
+	if q.pageTotal != PageTotalNone {
+		if !info.HasNext && (slice.Len() > 0 || q.pageNo == 0) {
+			// the last page, so the exact total is known
+			total, info.TotalEstimated = q.pageNo*q.pageSize+slice.Len(), false
+		} else if minTotal := (q.pageNo+1)*q.pageSize + 1; info.HasNext && total < minTotal {
+			// an estimate below the rows already seen
+			total = minTotal
+		}
+		pages := (total + q.pageSize - 1) / q.pageSize
+		info.Total, info.Pages = &total, &pages
+	}
+	return info, nil
+}
+
+func (q *Query) total(sample Model) (total int, estimated bool, err error) {
+	switch q.pageTotal {
+	case PageTotalExact:
+		total, err = q.Count(sample)
+		return total, false, err
+	case PageTotalEstimated, PageTotalAuto:
+		estimate, err := q.estimateCount(sample)
+		if err != nil {
+			return 0, false, err
+		}
+		if q.pageTotal == PageTotalAuto && estimate < pageTotalExactMaxRows {
+			total, err = q.Count(sample)
+			return total, false, err
+		}
+		return estimate, true, nil
+	}
+	return 0, false, merry.New("invalid page total").Appendf("total: %d", q.pageTotal)
+}
+
+// estimateCount uses the table statistics if the query reads the whole table, otherwise the planner's row estimate.
+func (q *Query) estimateCount(sample Model) (int, error) {
+	scope := q.gormDb.NewScope(sample)
+	if len(q.expressions) == 0 && !q.needsRawDb() && (q.includeDeleted || !scope.HasColumn("DeletedAt")) {
+		var reltuples float64
+		row := q.gormDb.New().Raw(`select coalesce(max(reltuples), -1) from pg_class where oid = to_regclass(?)`, scope.QuotedTableName()).Row()
+		if err := row.Scan(&reltuples); err != nil {
+			return 0, merry.Wrap(err).Appendf("estimating %T rows", sample)
+		}
+		// -1 if the table was never analyzed
+		if reltuples >= 0 {
+			return int(reltuples), nil
+		}
+	}
+
+	unpaged := *q
+	unpaged.pageNo, unpaged.pageSize = 0, 0
+	plan, err := unpaged.explain(queryModeSubquery, sample, false)
+	if err != nil {
+		return 0, err
+	}
+	return int(plan.EstimatedRows), nil
+}
+
+// sliceSample creates a model of the target's (a pointer to a slice of models) element type.
+func sliceSample(target interface{}) (Model, error) {
+	ty := reflect.TypeOf(target)
+	if ty == nil || ty.Kind() != reflect.Ptr || ty.Elem().Kind() != reflect.Slice {
+		return nil, merry.New("target must be a pointer to a slice").Appendf("found %T", target)
+	}
+	elem := ty.Elem().Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	sample, is := reflect.New(elem).Interface().(Model)
+	if !is {
+		return nil, merry.New("target elements must be models").Appendf("found %T", target)
+	}
+	return sample, nil
+}
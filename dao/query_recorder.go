@@ -0,0 +1,172 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ansel1/merry"
+	utils "github.com/coachbit/gorm-dao/dao/daoutils"
+)
+
+const (
+	daoPackagePrefix       = "github.com/coachbit/gorm-dao/dao."
+	daoSubpackagesPrefix   = "github.com/coachbit/gorm-dao/dao/"
+	maxRecordedCallSites   = 10
+	maxRecordedStackFrames = 32
+)
+
+type queryRecorderKey struct{}
+
+// RecordedQuery is the number of executions of one query descriptor within a recorder context.
+type RecordedQuery struct {
+	Descriptor string
+	Count      int
+	// CallSites are the distinct (first `maxRecordedCallSites`) places outside of this library which executed the query
+	CallSites []string
+}
+
+func (rq RecordedQuery) String() string {
+	return fmt.Sprintf("%dx %s (at %s)", rq.Count, rq.Descriptor, strings.Join(rq.CallSites, ", "))
+}
+
+// QueryRecorder counts queries by descriptor within a context (typically one HTTP request). Descriptors repeated more
+// than `threshold` times usually mean an N+1 pattern (Dao.ByID or Dao.Load called in a loop).
+type QueryRecorder struct {
+	threshold int
+
+	// OnRepeat (if set) is called once per descriptor, when its count first exceeds the threshold
+	OnRepeat func(c context.Context, rq RecordedQuery)
+
+	mutex   sync.Mutex
+	queries map[string]*RecordedQuery
+}
+
+// WithQueryRecorder attaches a new QueryRecorder to the context. All Dao and Query operations executed with the
+// returned context will be recorded.
+func WithQueryRecorder(c context.Context, threshold int) (context.Context, *QueryRecorder) {
+	r := &QueryRecorder{
+		threshold: threshold,
+		queries:   map[string]*RecordedQuery{},
+	}
+	return context.WithValue(c, queryRecorderKey{}, r), r
+}
+
+// QueryRecorderFromContext returns the recorder attached with WithQueryRecorder, or nil.
+func QueryRecorderFromContext(c context.Context) *QueryRecorder {
+	if c == nil {
+		return nil
+	}
+	r, _ := c.Value(queryRecorderKey{}).(*QueryRecorder)
+	return r
+}
+
+func recordQuery(c context.Context, descriptor string) {
+	if r := QueryRecorderFromContext(c); r != nil {
+		r.record(c, descriptor, callSite())
+	}
+}
+
+func (r *QueryRecorder) record(c context.Context, descriptor, site string) {
+	r.mutex.Lock()
+	rq, found := r.queries[descriptor]
+	if !found {
+		rq = &RecordedQuery{Descriptor: descriptor}
+		r.queries[descriptor] = rq
+	}
+	rq.Count++
+	if site != "" && len(rq.CallSites) < maxRecordedCallSites && !containsString(rq.CallSites, site) {
+		rq.CallSites = append(rq.CallSites, site)
+	}
+	exceeded := rq.Count == r.threshold+1
+	snapshot := rq.copy()
+	r.mutex.Unlock()
+
+	if exceeded && r.OnRepeat != nil {
+		r.OnRepeat(c, snapshot)
+	}
+}
+
+func (rq RecordedQuery) copy() RecordedQuery {
+	res := rq
+	res.CallSites = append([]string(nil), rq.CallSites...)
+	return res
+}
+
+// Count returns the number of executions of all recorded queries.
+func (r *QueryRecorder) Count() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	res := 0
+	for _, rq := range r.queries {
+		res += rq.Count
+	}
+	return res
+}
+
+// Repeated returns the queries executed more than `threshold` times, most repeated first.
+func (r *QueryRecorder) Repeated() []RecordedQuery {
+	r.mutex.Lock()
+	var res []RecordedQuery
+	for _, rq := range r.queries {
+		if rq.Count > r.threshold {
+			res = append(res, rq.copy())
+		}
+	}
+	r.mutex.Unlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count == res[j].Count {
+			return res[i].Descriptor < res[j].Descriptor
+		}
+		return res[i].Count > res[j].Count
+	})
+	return res
+}
+
+// Err returns an error describing all repeated queries, or nil if there are none. Useful to fail tests.
+func (r *QueryRecorder) Err() error {
+	repeated := r.Repeated()
+	if len(repeated) == 0 {
+		return nil
+	}
+	str := utils.NewStringBuilder()
+	for _, rq := range repeated {
+		str.Appendln(rq.String())
+	}
+	return merry.New("repeated queries (possible N+1)").Appendf("threshold %d:\n%s", r.threshold, str.StringTrimmed())
+}
+
+// callSite finds the first caller outside of this library.
+func callSite() string {
+	pcs := make([]uintptr, maxRecordedStackFrames)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !isLibraryFrame(frame.Function) {
+			return fmt.Sprintf("%s:%d %s", frame.File, frame.Line, frame.Function)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+func isLibraryFrame(function string) bool {
+	return strings.HasPrefix(function, daoPackagePrefix) ||
+		strings.HasPrefix(function, daoSubpackagesPrefix) ||
+		strings.HasPrefix(function, "runtime.")
+}
+
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,291 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	utils "github.com/coachbit/gorm-dao/dao/daoutils"
+)
+
+type ColumnDiff struct {
+	Table  string
+	Column string
+	// Expected is the sql type from the model (empty for extra columns)
+	Expected string
+	// Actual is the sql type in the database (empty for missing columns)
+	Actual string
+}
+
+type IndexDiff struct {
+	Table    string
+	Name     string
+	Expected *IndexInfo
+	Actual   *DbIndex
+}
+
+// MigrationsTable stores the applied sql migrations (see daocli.Migrator), SchemaDiff doesn't report it as an extra
+// table.
+const MigrationsTable = "schema_migrations"
+
+// SchemaDiff is the difference between the registered models (and indexes) and the database schema.
+type SchemaDiff struct {
+	Schema string
+
+	MissingTables  []string
+	ExtraTables    []string
+	MissingColumns []ColumnDiff
+	ExtraColumns   []ColumnDiff
+	TypeMismatches []ColumnDiff
+	MissingIndexes []IndexDiff
+	ExtraIndexes   []IndexDiff
+	// IndexMismatches are indexes with the same name, but different columns or uniqueness
+	IndexMismatches []IndexDiff
+
+	// createTables are CREATE TABLE statements for missing tables
+	createTables map[string]string
+}
+
+func (sd SchemaDiff) IsEmpty() bool {
+	return len(sd.MissingTables)+len(sd.ExtraTables)+len(sd.MissingColumns)+len(sd.ExtraColumns)+
+		len(sd.TypeMismatches)+len(sd.MissingIndexes)+len(sd.ExtraIndexes)+len(sd.IndexMismatches) == 0
+}
+
+func (sd SchemaDiff) String() string {
+	if sd.IsEmpty() {
+		return "no differences"
+	}
+	str := utils.NewStringBuilder()
+	for _, t := range sd.MissingTables {
+		str.Appendf("missing table: %s\n", t)
+	}
+	for _, t := range sd.ExtraTables {
+		str.Appendf("extra table: %s\n", t)
+	}
+	for _, col := range sd.MissingColumns {
+		str.Appendf("missing column: %s.%s %s\n", col.Table, col.Column, col.Expected)
+	}
+	for _, col := range sd.ExtraColumns {
+		str.Appendf("extra column: %s.%s %s\n", col.Table, col.Column, col.Actual)
+	}
+	for _, col := range sd.TypeMismatches {
+		str.Appendf("type mismatch: %s.%s expected %s, found %s\n", col.Table, col.Column, col.Expected, col.Actual)
+	}
+	for _, idx := range sd.MissingIndexes {
+		str.Appendf("missing index: %s on %s (%s)\n", idx.Name, idx.Table, strings.Join(idx.Expected.Columns, ", "))
+	}
+	for _, idx := range sd.ExtraIndexes {
+		str.Appendf("extra index: %s on %s (%s)\n", idx.Name, idx.Table, strings.Join(idx.Actual.Columns, ", "))
+	}
+	for _, idx := range sd.IndexMismatches {
+		str.Appendf("index mismatch: %s on %s expected (%s) unique=%t, found (%s) unique=%t\n", idx.Name, idx.Table,
+			strings.Join(idx.Expected.Columns, ", "), idx.Expected.Unique, strings.Join(idx.Actual.Columns, ", "), idx.Actual.Unique)
+	}
+	return str.String()
+}
+
+// SQL returns statements to reconcile the database with the models. Destructive statements (dropping extra tables,
+// columns and indexes) are commented out.
+func (sd SchemaDiff) SQL() []string {
+	var res []string
+	for _, t := range sd.MissingTables {
+		res = append(res, sd.createTables[t])
+	}
+	for _, col := range sd.MissingColumns {
+		res = append(res, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", QuoteIdentifier(col.Table), QuoteIdentifier(col.Column), col.Expected))
+	}
+	for _, col := range sd.TypeMismatches {
+		res = append(res, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s USING %s::%s;", QuoteIdentifier(col.Table), QuoteIdentifier(col.Column), col.Expected, QuoteIdentifier(col.Column), col.Expected))
+	}
+	for _, idx := range sd.IndexMismatches {
+		res = append(res, fmt.Sprintf("DROP INDEX %s;", QuoteIdentifier(idx.Name)))
+		res = append(res, createIndexSQL(*idx.Expected))
+	}
+	for _, idx := range sd.MissingIndexes {
+		res = append(res, createIndexSQL(*idx.Expected))
+	}
+	for _, idx := range sd.ExtraIndexes {
+		res = append(res, fmt.Sprintf("-- DROP INDEX %s;", QuoteIdentifier(idx.Name)))
+	}
+	for _, col := range sd.ExtraColumns {
+		res = append(res, fmt.Sprintf("-- ALTER TABLE %s DROP COLUMN %s;", QuoteIdentifier(col.Table), QuoteIdentifier(col.Column)))
+	}
+	for _, t := range sd.ExtraTables {
+		res = append(res, fmt.Sprintf("-- DROP TABLE %s;", QuoteIdentifier(t)))
+	}
+	return res
+}
+
+func createIndexSQL(idx IndexInfo) string {
+	unique := ""
+	if idx.Unique {
+		unique = "UNIQUE "
+	}
+	using := ""
+	if idx.Method != "" {
+		using = "USING " + idx.Method + " "
+	}
+	var columns []string
+	if idx.Expression != "" {
+		columns = []string{strings.TrimSpace("(" + idx.Expression + ") " + idx.OpClass)}
+	} else {
+		for _, col := range idx.Columns {
+			columns = append(columns, strings.TrimSpace(QuoteIdentifier(col)+" "+idx.OpClass))
+		}
+	}
+	return fmt.Sprintf("CREATE %sINDEX %s ON %s %s(%s);", unique, QuoteIdentifier(idx.Name), QuoteIdentifier(idx.Table), using, strings.Join(columns, ", "))
+}
+
+func createTableSQL(table string, columns []modelColumn) string {
+	var defs, pks []string
+	for _, col := range columns {
+		def := QuoteIdentifier(col.Name) + " " + col.SQLType
+		if !col.Nullable && !col.Primary {
+			def += " NOT NULL"
+		}
+		if col.Default != "" {
+			def += " DEFAULT " + col.Default
+		}
+		defs = append(defs, def)
+		if col.Primary {
+			pks = append(pks, col.Name)
+		}
+	}
+	if len(pks) > 0 {
+		defs = append(defs, "PRIMARY KEY ("+quoteIdentifiers(pks)+")")
+	}
+	return fmt.Sprintf("CREATE TABLE %s (%s);", QuoteIdentifier(table), strings.Join(defs, ", "))
+}
+
+// SchemaDiff compares the registered models and indexes (AddIndex, AddUniqueIndex and index tags) with the "public"
+// schema of the database.
+func (d *Dao) SchemaDiff(c context.Context) (*SchemaDiff, error) {
+	return d.SchemaDiffIn(c, defaultSchema)
+}
+
+func (d *Dao) SchemaDiffIn(c context.Context, schema string) (*SchemaDiff, error) {
+	infos, err := d.modelInfos()
+	if err != nil {
+		return nil, err
+	}
+	live, err := d.IntrospectSchema(c, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	db := d.metaDb()
+	res := &SchemaDiff{Schema: live.Schema, createTables: map[string]string{}}
+	modelTables := map[string]bool{}
+	for _, mi := range infos {
+		modelTables[mi.table] = true
+		columns := modelColumns(db, mi)
+		liveTable, found := live.Tables[mi.table]
+		if !found {
+			res.MissingTables = append(res.MissingTables, mi.table)
+			res.createTables[mi.table] = createTableSQL(mi.table, columns)
+			for _, idx := range d.modelIndexes(mi) {
+				idx := idx
+				res.MissingIndexes = append(res.MissingIndexes, IndexDiff{Table: mi.table, Name: idx.Name, Expected: &idx})
+			}
+			continue
+		}
+
+		for _, col := range columns {
+			liveCol, found := liveTable.Column(col.Name)
+			if !found {
+				res.MissingColumns = append(res.MissingColumns, ColumnDiff{Table: mi.table, Column: col.Name, Expected: col.SQLType})
+			} else if col.SQLType != "?" && normalizeSQLType(col.SQLType) != normalizeSQLType(liveCol.DataType) {
+				res.TypeMismatches = append(res.TypeMismatches, ColumnDiff{Table: mi.table, Column: col.Name, Expected: col.SQLType, Actual: liveCol.DataType})
+			}
+		}
+		for _, liveCol := range liveTable.Columns {
+			if !modelHasColumn(columns, liveCol.Name) {
+				res.ExtraColumns = append(res.ExtraColumns, ColumnDiff{Table: mi.table, Column: liveCol.Name, Actual: liveCol.DataType})
+			}
+		}
+
+		indexes := d.modelIndexes(mi)
+		for n := range indexes {
+			idx := indexes[n]
+			liveIdx := findDbIndex(liveTable.Indexes, idx.Name)
+			if liveIdx == nil {
+				res.MissingIndexes = append(res.MissingIndexes, IndexDiff{Table: mi.table, Name: idx.Name, Expected: &idx})
+			} else if liveIdx.Unique != idx.Unique || (idx.Expression == "" && strings.Join(liveIdx.Columns, ",") != strings.Join(idx.Columns, ",")) {
+				res.IndexMismatches = append(res.IndexMismatches, IndexDiff{Table: mi.table, Name: idx.Name, Expected: &idx, Actual: liveIdx})
+			}
+		}
+		for n := range liveTable.Indexes {
+			liveIdx := liveTable.Indexes[n]
+			if !liveIdx.Primary && !hasIndex(indexes, liveIdx.Name) {
+				res.ExtraIndexes = append(res.ExtraIndexes, IndexDiff{Table: mi.table, Name: liveIdx.Name, Actual: &liveIdx})
+			}
+		}
+	}
+	for _, table := range live.TableNames() {
+		if !modelTables[table] && table != MigrationsTable {
+			res.ExtraTables = append(res.ExtraTables, table)
+		}
+	}
+	sort.Strings(res.MissingTables)
+	return res, nil
+}
+
+func findDbIndex(indexes []DbIndex, name string) *DbIndex {
+	for n := range indexes {
+		if indexes[n].Name == name {
+			return &indexes[n]
+		}
+	}
+	return nil
+}
+
+var (
+	sqlTypeSpacesRegexp = regexp.MustCompile(`\s+`)
+	sqlTypeAliases      = map[string]string{
+		"serial":      "integer",
+		"serial4":     "integer",
+		"int":         "integer",
+		"int4":        "integer",
+		"bigserial":   "bigint",
+		"serial8":     "bigint",
+		"int8":        "bigint",
+		"smallserial": "smallint",
+		"int2":        "smallint",
+		"bool":        "boolean",
+		"float8":      "double precision",
+		"float4":      "real",
+		"decimal":     "numeric",
+		"timestamptz": "timestamp with time zone",
+		"timestamp":   "timestamp without time zone",
+		"timetz":      "time with time zone",
+		"time":        "time without time zone",
+		"varchar":     "character varying",
+		"char":        "character",
+		"bpchar":      "character",
+		"varbit":      "bit varying",
+	}
+)
+
+// normalizeSQLType maps postgres type aliases (and array element aliases) to the names used in information_schema.
+func normalizeSQLType(sqlType string) string {
+	t := strings.ToLower(strings.TrimSpace(sqlTypeSpacesRegexp.ReplaceAllString(sqlType, " ")))
+	array := ""
+	for strings.HasSuffix(t, "[]") {
+		t = strings.TrimSuffix(t, "[]")
+		array += "[]"
+	}
+	size := ""
+	if i := strings.Index(t, "("); i > 0 {
+		t, size = strings.TrimSpace(t[:i]), strings.ReplaceAll(t[i:], " ", "")
+	}
+	if alias, found := sqlTypeAliases[t]; found {
+		t = alias
+	}
+	if t == "numeric" {
+		// precision is not set by gorm
+		size = ""
+	}
+	return t + size + array
+}
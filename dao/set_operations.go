@@ -0,0 +1,93 @@
+package dao
+
+import (
+	"strings"
+)
+
+type setOperation struct {
+	operator string
+	query    *Query
+}
+
+// compoundSource is the source of a query combined from other queries (of the same model) with set operations
+type compoundSource struct {
+	first      *Query
+	operations []setOperation
+}
+
+func (cs *compoundSource) render(sample interface{}) (string, []interface{}, error) {
+	sql, values, err := cs.first.renderQuery(queryModeSubquery, sample)
+	if err != nil {
+		return "", nil, err
+	}
+	// every part is in parentheses, so that it can have its own ordering and paging
+	parts := []string{"(" + sql + ")"}
+	for _, op := range cs.operations {
+		sql, opValues, err := op.query.renderQuery(queryModeSubquery, sample)
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, op.operator, "("+sql+")")
+		values = append(values, opValues...)
+	}
+	return "(" + strings.Join(parts, " ") + ")", values, nil
+}
+
+// Union combines the results of two queries of the same model (without duplicates). The result is a new query, which
+// can be filtered, ordered, paged and counted like any other query (filters with table-qualified columns work, the
+// combined rows are aliased with the table name). The parts are not paged unless their page size is set explicitly.
+func (q *Query) Union(other *Query) *Query {
+	return q.combine("UNION", other)
+}
+
+// UnionAll is Union which keeps duplicates.
+func (q *Query) UnionAll(other *Query) *Query {
+	return q.combine("UNION ALL", other)
+}
+
+// Intersect keeps rows returned by both queries (see Union).
+func (q *Query) Intersect(other *Query) *Query {
+	return q.combine("INTERSECT", other)
+}
+
+// Except keeps rows of this query which are not returned by the other query (see Union).
+func (q *Query) Except(other *Query) *Query {
+	return q.combine("EXCEPT", other)
+}
+
+func (q *Query) combine(operator string, other *Query) *Query {
+	descr := strings.ToLower(strings.ReplaceAll(operator, " ", "_")) + "[" + other.getLogStr() + "]"
+	if q.isPlainCompound() {
+		// a.Union(b).Union(c) is rendered as (a) UNION (b) UNION (c)
+		q.compound.operations = append(q.compound.operations, setOperation{operator: operator, query: other})
+		q.logStr = append(q.logStr, descr)
+		q.err = firstErr(q.err, other.err)
+		return q
+	}
+	return &Query{
+		gormDb:         q.gormDb,
+		logger:         q.logger,
+		c:              q.c,
+		statsCollector: q.statsCollector,
+		tracer:         q.tracer,
+		knownColumns:   q.knownColumns,
+		err:            firstErr(q.err, other.err),
+		logStr:         []string{"[" + q.getLogStr() + "]", descr},
+		compound:       &compoundSource{first: q, operations: []setOperation{{operator: operator, query: other}}},
+	}
+}
+
+// isPlainCompound is true for combined queries without own filters, ordering, paging...
+func (q *Query) isPlainCompound() bool {
+	return q.compound != nil && len(q.expressions) == 0 && len(q.orderBy) == 0 && len(q.ctes) == 0 &&
+		q.pageNo == 0 && q.pageSize == 0 && q.fromCTE == "" && q.distinct == "" && !q.includeDeleted
+}
+
+func firstErr(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
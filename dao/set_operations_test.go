@@ -0,0 +1,30 @@
+package dao
+
+import (
+	"context"
+	"testing"
+)
+
+type setOperationsModel struct {
+	BaseModel
+	Email string
+}
+
+func TestUnionSortFromRequest(t *testing.T) {
+	t.Parallel()
+
+	d := New("1", "postgres", "", &setOperationsModel{})
+	a := d.Query(context.Background()).Filter("email", "=", "a")
+	b := d.Query(context.Background()).Filter("email", "=", "b")
+	sql, values, err := a.Union(b).SortFromRequest("-email").ToSQL(&setOperationsModel{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `SELECT * FROM ((SELECT * FROM "set_operations_models"  WHERE ( ("email" = $1) )) UNION (SELECT * FROM "set_operations_models"  WHERE ( ("email" = $2) ))) AS "set_operations_models"   ORDER BY "email" desc LIMIT 50`
+	if sql != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, sql)
+	}
+	if len(values) != 2 || values[0] != "a" || values[1] != "b" {
+		t.Errorf("invalid values: %#v", values)
+	}
+}
@@ -0,0 +1,190 @@
+package dao
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const RedactedValue = "[REDACTED]"
+
+// SQLLogEntry is one sql statement logged by gorm (only when Dao.Debug is set or Dao.SQLLogger is configured).
+type SQLLogEntry struct {
+	SQL      string
+	Vars     []interface{}
+	Duration time.Duration
+	Rows     int64
+	// Source is the file:line of the gorm call
+	Source string
+}
+
+type StructuredLogger interface {
+	LogSQL(c context.Context, entry SQLLogEntry)
+}
+
+// contextLogger is a gorm logger for one db operation, so that the sql is logged with the operation context.
+type contextLogger struct {
+	d *Dao
+	c context.Context
+}
+
+func (cl contextLogger) Print(v ...interface{}) {
+	cl.d.print(cl.c, v...)
+}
+
+// AddRedactedColumns sets columns whose values will never be logged (matched by name, case insensitive).
+func (d *Dao) AddRedactedColumns(columns ...string) {
+	if d.redactedColumns == nil {
+		d.redactedColumns = map[string]bool{}
+	}
+	for _, col := range columns {
+		d.redactedColumns[strings.ToLower(col)] = true
+	}
+}
+
+func (d *Dao) print(c context.Context, v ...interface{}) {
+	if len(v) >= 6 && v[0] == "sql" {
+		sql, _ := v[3].(string)
+		vars, _ := v[4].([]interface{})
+		vars = redactSQLVars(sql, vars, d.redactedColumns)
+		if d.SQLLogger != nil {
+			duration, _ := v[2].(time.Duration)
+			rows, _ := v[5].(int64)
+			d.SQLLogger.LogSQL(c, SQLLogEntry{
+				SQL:      sql,
+				Vars:     vars,
+				Duration: duration,
+				Rows:     rows,
+				Source:   fmt.Sprint(v[1]),
+			})
+			return
+		}
+		v = append(append([]interface{}{}, v[:4]...), append([]interface{}{vars}, v[5:]...)...)
+	}
+
+	var byts bytes.Buffer
+	for _, msg := range gorm.LogFormatter(v...) {
+		byts.WriteString(strings.TrimSpace(fmt.Sprintf("%v", msg)))
+		byts.WriteRune(' ')
+	}
+	d.Logger.Debugf(c, "%s", byts.String())
+}
+
+var (
+	sqlInsertRegexp      = regexp.MustCompile(`(?is)insert\s+into\s+\S+\s*\(([^)]*)\)\s*values\s*\(([^)]*)\)`)
+	sqlInListRegexp      = regexp.MustCompile(`(?is)([\w"]+)\s+(?:not\s+)?in\s*\(([^)]*)\)`)
+	sqlComparisonRegexp  = regexp.MustCompile(`(?is)([\w"]+)\s*(?:=|<>|!=|<=|>=|<|>|\s(?:not\s+)?i?like\s)\s*(\$\d+)`)
+	sqlPlaceholderRegexp = regexp.MustCompile(`\$\d+`)
+)
+
+// redactSQLVars replaces values bound to the redacted columns. Placeholders are mapped to columns from INSERT column
+// lists, `column <op> $n` comparisons/assignments and `column in ($n, ...)` lists. String literals and comments are
+// ignored.
+func redactSQLVars(sql string, vars []interface{}, redactedColumns map[string]bool) []interface{} {
+	if len(redactedColumns) == 0 || len(vars) == 0 {
+		return vars
+	}
+	sql = blankSQLLiterals(sql)
+	if !sqlPlaceholderRegexp.MatchString(sql) {
+		// with `$n` placeholders (postgres), `?` are jsonb operators
+		sql = numberQuestionMarks(sql)
+	}
+
+	redacted := map[int]bool{}
+	isRedacted := func(column string) bool {
+		column = strings.Trim(column, `"`)
+		return redactedColumns[strings.ToLower(column)]
+	}
+
+	for _, match := range sqlInsertRegexp.FindAllStringSubmatch(sql, -1) {
+		columns := strings.Split(match[1], ",")
+		values := strings.Split(match[2], ",")
+		for n := range columns {
+			if n < len(values) && isRedacted(strings.TrimSpace(columns[n])) {
+				for _, placeholder := range sqlPlaceholderRegexp.FindAllString(values[n], -1) {
+					redacted[placeholderIndex(placeholder)] = true
+				}
+			}
+		}
+	}
+	for _, match := range sqlInListRegexp.FindAllStringSubmatch(sql, -1) {
+		if isRedacted(match[1]) {
+			for _, placeholder := range sqlPlaceholderRegexp.FindAllString(match[2], -1) {
+				redacted[placeholderIndex(placeholder)] = true
+			}
+		}
+	}
+	for _, match := range sqlComparisonRegexp.FindAllStringSubmatch(sql, -1) {
+		if isRedacted(match[1]) {
+			redacted[placeholderIndex(match[2])] = true
+		}
+	}
+
+	if len(redacted) == 0 {
+		return vars
+	}
+	res := make([]interface{}, len(vars))
+	for n := range vars {
+		if redacted[n] {
+			res[n] = RedactedValue
+		} else {
+			res[n] = vars[n]
+		}
+	}
+	return res
+}
+
+// blankSQLLiterals replaces string literals with empty ones and comments with a space (quoted identifiers are kept), so
+// that placeholders and operators inside them aren't matched. The sql is returned as is if it can't be parsed.
+func blankSQLLiterals(sql string) string {
+	var res strings.Builder
+	for i := 0; i < len(sql); i++ {
+		end, err := skipSQLLiteral(sql, i)
+		if err != nil {
+			return sql
+		}
+		switch {
+		case end == i:
+			res.WriteByte(sql[i])
+			continue
+		case sql[i] == '"':
+			res.WriteString(sql[i:end])
+		case strings.HasPrefix(sql[i:], "--") || strings.HasPrefix(sql[i:], "/*"):
+			res.WriteByte(' ')
+		default:
+			res.WriteString("''")
+		}
+		i = end - 1
+	}
+	return res.String()
+}
+
+// numberQuestionMarks converts `?` placeholders (non-postgres dialects) to `$n`.
+func numberQuestionMarks(sql string) string {
+	if !strings.Contains(sql, "?") {
+		return sql
+	}
+	var res strings.Builder
+	n := 0
+	for _, r := range sql {
+		if r == '?' {
+			n++
+			res.WriteString("$" + strconv.Itoa(n))
+		} else {
+			res.WriteRune(r)
+		}
+	}
+	return res.String()
+}
+
+// placeholderIndex returns the (zero-based) index of a `$n` placeholder.
+func placeholderIndex(placeholder string) int {
+	n, _ := strconv.Atoi(strings.TrimPrefix(placeholder, "$"))
+	return n - 1
+}
@@ -0,0 +1,31 @@
+package dao
+
+import (
+	"context"
+	"log/slog"
+)
+
+var _ StructuredLogger = new(SlogSQLLogger)
+
+// SlogSQLLogger sends sql logs to a log/slog logger.
+type SlogSQLLogger struct {
+	Logger *slog.Logger
+	Level  slog.Level
+}
+
+func NewSlogSQLLogger(logger *slog.Logger) *SlogSQLLogger {
+	return &SlogSQLLogger{Logger: logger, Level: slog.LevelDebug}
+}
+
+func (l *SlogSQLLogger) LogSQL(c context.Context, entry SQLLogEntry) {
+	if c == nil {
+		c = context.Background()
+	}
+	l.Logger.LogAttrs(c, l.Level, "sql",
+		slog.String("sql", entry.SQL),
+		slog.Any("vars", entry.Vars),
+		slog.Duration("duration", entry.Duration),
+		slog.Int64("rows", entry.Rows),
+		slog.String("source", entry.Source),
+	)
+}
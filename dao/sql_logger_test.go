@@ -0,0 +1,53 @@
+package dao
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedactSQLVars(t *testing.T) {
+	t.Parallel()
+
+	redacted := map[string]bool{"password": true, "token": true}
+	for _, tc := range []struct {
+		name     string
+		sql      string
+		vars     []interface{}
+		expected []interface{}
+	}{
+		{
+			name:     "insert",
+			sql:      `INSERT INTO "users" ("email","password") VALUES ($1,$2)`,
+			vars:     []interface{}{"e", "p"},
+			expected: []interface{}{"e", RedactedValue},
+		},
+		{
+			name:     "comparison and in list",
+			sql:      `SELECT * FROM "users" WHERE ("email" = $1) AND ("token" in ($2,$3))`,
+			vars:     []interface{}{"e", "t1", "t2"},
+			expected: []interface{}{"e", RedactedValue, RedactedValue},
+		},
+		{
+			name:     "jsonb operators",
+			sql:      `SELECT * FROM "users" WHERE (settings ? $1) AND (tags ?| $2) AND ("password" = $3)`,
+			vars:     []interface{}{"k", "t", "p"},
+			expected: []interface{}{"k", "t", RedactedValue},
+		},
+		{
+			name:     "literals",
+			sql:      `SELECT * FROM "users" WHERE (note = 'password = $1') AND ("email" = $1) /* token = $2 */ AND ("password" = $2)`,
+			vars:     []interface{}{"e", "p"},
+			expected: []interface{}{"e", RedactedValue},
+		},
+		{
+			name:     "question marks",
+			sql:      "SELECT * FROM `users` WHERE (note = 'a?') AND (email = ?) AND (password = ?)",
+			vars:     []interface{}{"e", "p"},
+			expected: []interface{}{"e", RedactedValue},
+		},
+	} {
+		if res := redactSQLVars(tc.sql, tc.vars, redacted); !reflect.DeepEqual(res, tc.expected) {
+			t.Errorf("%s: expected %#v, got %#v", tc.name, tc.expected, res)
+		}
+	}
+}
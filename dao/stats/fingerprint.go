@@ -0,0 +1,29 @@
+package stats
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	fingerprintPageRegexp    = regexp.MustCompile(`(^|\s)page:\d+`)
+	fingerprintStringRegexp  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	fingerprintNumberRegexp  = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	fingerprintInListRegexp  = regexp.MustCompile(`(?i)\b(in)\s*\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	fingerprintSpacesRegexp  = regexp.MustCompile(`\s+`)
+	fingerprintDollarsRegexp = regexp.MustCompile(`\$\d+`)
+)
+
+// Fingerprint normalizes a query descriptor to its "shape": page numbers are dropped, string and number literals are
+// replaced with `?`, and `in (?,?,...)` lists of any length are collapsed to `in (?...)`.
+//
+// Type names (like `*models.User2`) are kept, digits are replaced only when not a part of an identifier.
+func Fingerprint(descriptor string) string {
+	res := fingerprintPageRegexp.ReplaceAllString(descriptor, "")
+	res = fingerprintStringRegexp.ReplaceAllString(res, "?")
+	res = fingerprintDollarsRegexp.ReplaceAllString(res, "?")
+	res = fingerprintNumberRegexp.ReplaceAllString(res, "?")
+	res = fingerprintInListRegexp.ReplaceAllString(res, "$1 (?...)")
+	res = fingerprintSpacesRegexp.ReplaceAllString(res, " ")
+	return strings.TrimSpace(res)
+}
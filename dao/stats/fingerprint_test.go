@@ -0,0 +1,31 @@
+package stats
+
+import "testing"
+
+func TestFingerprint(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name        string
+		descriptor  string
+		fingerprint string
+	}{
+		{name: "string literal", descriptor: "select * from users where email = 'a@b.c'", fingerprint: "select * from users where email = ?"},
+		{name: "doubled quotes", descriptor: "where name = 'it''s' and x = 'y'", fingerprint: "where name = ? and x = ?"},
+		{name: "numbers", descriptor: "limit 10 offset 20 where score > 1.5", fingerprint: "limit ? offset ? where score > ?"},
+		{name: "identifiers with digits", descriptor: "loading *models.User2 from t1 where v2 = 3", fingerprint: "loading *models.User2 from t1 where v2 = ?"},
+		{name: "dollar placeholders", descriptor: "where id = $1 and org_id = $12", fingerprint: "where id = ? and org_id = ?"},
+		{name: "in list", descriptor: "where id in (1, 2, 3)", fingerprint: "where id in (?...)"},
+		{name: "in list lengths", descriptor: "where id in ('a') or x IN ($1,$2)", fingerprint: "where id in (?...) or x IN (?...)"},
+		{name: "not in list", descriptor: "where id NOT IN ( ? , ? )", fingerprint: "where id NOT IN (?...)"},
+		{name: "in subquery", descriptor: "where id in (select id from t)", fingerprint: "where id in (select id from t)"},
+		{name: "page", descriptor: "users page:3 filter:email = 'x'", fingerprint: "users filter:email = ?"},
+		{name: "whitespace", descriptor: "  select *\n\tfrom   users\n where id = 1  ", fingerprint: "select * from users where id = ?"},
+		{name: "case is kept", descriptor: "SELECT * FROM Users WHERE ID = 1", fingerprint: "SELECT * FROM Users WHERE ID = ?"},
+		{name: "empty", descriptor: "", fingerprint: ""},
+	} {
+		if fp := Fingerprint(tc.descriptor); fp != tc.fingerprint {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.fingerprint, fp)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package stats
+
+type Outcome int
+
+const (
+	OutcomeOK              Outcome = iota
+	OutcomeNotFound        Outcome = iota
+	OutcomeUniqueViolation Outcome = iota
+	OutcomeError           Outcome = iota
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeOK:
+		return "ok"
+	case OutcomeNotFound:
+		return "not found"
+	case OutcomeUniqueViolation:
+		return "unique violation"
+	case OutcomeError:
+		return "error"
+	}
+	return "unknown"
+}
+
+// Result of one query execution.
+type Result struct {
+	Outcome Outcome
+	// Rows returned or affected, negative if unknown
+	Rows int64
+}
+
+// ResultUnknownRows is used for successful queries without row counts (like iterators).
+var ResultUnknownRows = Result{Outcome: OutcomeOK, Rows: -1}
@@ -15,9 +15,29 @@ import (
 
 type queryStat struct {
 	queryDescriptor string
-	count           int
-	min, max, sum   time.Duration
-	avg             time.Duration
+	// example is the first raw (not normalized) descriptor
+	example       string
+	count         int
+	min, max, sum time.Duration
+	avg           time.Duration
+
+	notFound, uniqueViolations, errors int
+	// rowsCount is the number of executions with known number of rows
+	rowsCount, rowsSum int64
+}
+
+func (qs queryStat) errorRate() float64 {
+	if qs.count == 0 {
+		return 0
+	}
+	return 100 * float64(qs.errors+qs.uniqueViolations) / float64(qs.count)
+}
+
+func (qs queryStat) avgRows() string {
+	if qs.rowsCount == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f", float64(qs.rowsSum)/float64(qs.rowsCount))
 }
 
 type queryStats []queryStat
@@ -27,8 +47,10 @@ func (s queryStats) Less(i, j int) bool { return s[i].avg < s[j].avg }
 func (s queryStats) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 
 type dbSnapshot struct {
-	query string
-	d     time.Duration
+	query   string
+	example string
+	d       time.Duration
+	res     Result
 }
 
 type StatsCollector struct {
@@ -38,6 +60,10 @@ type StatsCollector struct {
 	statsLock  sync.RWMutex
 	statsCh    chan dbSnapshot
 	LastReport string
+
+	// Normalize maps raw query descriptors to the keys used to aggregate stats (Fingerprint by default). Set it
+	// to nil to aggregate by raw descriptors.
+	Normalize func(descriptor string) string
 }
 
 func NewStatsCollector(title string, interval time.Duration, top int) *StatsCollector {
@@ -46,6 +72,7 @@ func NewStatsCollector(title string, interval time.Duration, top int) *StatsColl
 	s.statsCh = make(chan dbSnapshot)
 	s.stats = map[string]queryStat{}
 	s.title = strings.ToUpper(title)
+	s.Normalize = Fingerprint
 
 	go func() {
 		defer func() { _ = utils.CheckPanicOrLog(recover(), nil) }()
@@ -81,6 +108,9 @@ func NewStatsCollector(title string, interval time.Duration, top int) *StatsColl
 
 			curr.count++
 			curr.queryDescriptor = st.query
+			if curr.example == "" {
+				curr.example = st.example
+			}
 			curr.sum = curr.sum + st.d
 			curr.avg = time.Duration(int64(curr.sum) / int64(curr.count))
 			if curr.max == 0 || st.d > curr.max {
@@ -89,6 +119,18 @@ func NewStatsCollector(title string, interval time.Duration, top int) *StatsColl
 			if curr.min == 0 || st.d < curr.min {
 				curr.min = st.d
 			}
+			switch st.res.Outcome {
+			case OutcomeNotFound:
+				curr.notFound++
+			case OutcomeUniqueViolation:
+				curr.uniqueViolations++
+			case OutcomeError:
+				curr.errors++
+			}
+			if st.res.Rows >= 0 {
+				curr.rowsCount++
+				curr.rowsSum += st.res.Rows
+			}
 
 			s.statsLock.Lock()
 			s.stats[st.query] = curr
@@ -106,12 +148,24 @@ func (s *StatsCollector) Reset() {
 }
 
 func (s *StatsCollector) AddStats(c context.Context, since time.Time, queryFmt string, params ...interface{}) {
+	s.Record(c, since, ResultUnknownRows, queryFmt, params...)
+}
+
+// Record is AddStats with the outcome and number of rows of the query (no-op on a nil collector).
+func (s *StatsCollector) Record(c context.Context, since time.Time, res Result, queryFmt string, params ...interface{}) {
+	if s == nil {
+		return
+	}
 	if queryFmt == "" {
 		fmt.Fprintf(os.Stderr, "empty query descriptor:"+string(debug.Stack()))
 	}
 	duration := time.Since(since)
-	query := fmt.Sprintf(queryFmt, params...)
-	s.statsCh <- dbSnapshot{query: query, d: duration}
+	example := fmt.Sprintf(queryFmt, params...)
+	query := example
+	if s.Normalize != nil {
+		query = s.Normalize(example)
+	}
+	s.statsCh <- dbSnapshot{query: query, example: example, d: duration, res: res}
 }
 
 func (s *StatsCollector) formatDuration(d time.Duration) string {
@@ -129,7 +183,7 @@ func (s *StatsCollector) PrintStatsAndReset() {
 
 	str := utils.NewStringBuilder()
 
-	str.Appendln(s.title, " (avg/min/max/count):")
+	str.Appendln(s.title, " (avg/min/max/count/error rate/not found/avg rows):")
 	if len(list) == 0 {
 		str.Appendln("empty")
 		goto report
@@ -137,7 +191,10 @@ func (s *StatsCollector) PrintStatsAndReset() {
 
 	sort.Sort(queryStats(list))
 	for count, i := 0, len(list)-1; i >= 0; i-- {
-		str.Appendf("%50s  %s\n", fmt.Sprint(s.formatDuration(list[i].avg), "/", s.formatDuration(list[i].min), "/", s.formatDuration(list[i].max), "/n=", list[i].count), list[i].queryDescriptor)
+		str.Appendf("%75s  %s\n", fmt.Sprint(s.formatDuration(list[i].avg), "/", s.formatDuration(list[i].min), "/", s.formatDuration(list[i].max), "/n=", list[i].count, fmt.Sprintf("/err=%.1f%%", list[i].errorRate()), "/nf=", list[i].notFound, "/rows=", list[i].avgRows()), list[i].queryDescriptor)
+		if list[i].example != list[i].queryDescriptor {
+			str.Appendf("%75s  e.g. %s\n", "", list[i].example)
+		}
 		count++
 		if count > s.top {
 			goto report
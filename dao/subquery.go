@@ -0,0 +1,57 @@
+package dao
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// FilterInSubquery filters by `column in (select selectColumn from ...)`, the subquery is built from another Query (its
+// filters, ordering and deleted rows handling are kept, but it's not paged unless the page size is set explicitly).
+// Both columns are validated and quoted.
+func (q *Query) FilterInSubquery(column string, sub *Query, sample Model, selectColumn string) *Query {
+	quoted, err := quoteColumn(selectColumn)
+	if err != nil {
+		q.err = firstErr(q.err, err)
+		return q
+	}
+	expr, err := sub.subqueryExpr(sample, quoted)
+	if err != nil {
+		q.err = firstErr(q.err, err)
+		return q
+	}
+	q.appendFilterExpressionAndValues("subquery["+sub.getLogStr()+"]", q.column(column)+" in (?)", expr)
+	return q
+}
+
+// FilterExists filters by `exists (select 1 from ...)`, correlate the subquery with raw expressions referencing the
+// outer table (for example `subscriptions.user_id = users.id`).
+func (q *Query) FilterExists(sub *Query, sample Model) *Query {
+	return q.filterExists("exists", sub, sample)
+}
+
+// FilterNotExists is the negation of FilterExists.
+func (q *Query) FilterNotExists(sub *Query, sample Model) *Query {
+	return q.filterExists("not exists", sub, sample)
+}
+
+func (q *Query) filterExists(operator string, sub *Query, sample Model) *Query {
+	expr, err := sub.subqueryExpr(sample, "1")
+	if err != nil {
+		q.err = firstErr(q.err, err)
+		return q
+	}
+	q.appendFilterExpressionAndValues("subquery["+sub.getLogStr()+"]", operator+" (?)", expr)
+	return q
+}
+
+// subqueryExpr renders the query as an expression with its own values, gorm merges them with the outer placeholders.
+func (q *Query) subqueryExpr(sample Model, selectColumn string) (*gorm.SqlExpr, error) {
+	db, sourceValues, err := q.sqlDb(queryModeSubquery, sample)
+	if err != nil {
+		return nil, err
+	}
+	sql, values, err := q.renderSQL(db.Select(q.selectExpr(selectColumn)), sourceValues)
+	if err != nil {
+		return nil, err
+	}
+	return gorm.Expr(sql, values...), nil
+}
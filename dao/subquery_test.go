@@ -0,0 +1,40 @@
+package dao
+
+import (
+	"context"
+	"testing"
+)
+
+type subqueryUser struct {
+	BaseModel
+	Email string
+}
+
+type subqueryOrder struct {
+	BaseModel
+	UserID string
+}
+
+func TestFilterInSubquery(t *testing.T) {
+	t.Parallel()
+
+	d := New("1", "postgres", "", &subqueryUser{}, &subqueryOrder{})
+	sub := d.Query(context.Background()).Filter("user_id", "<>", "x")
+	sql, values, err := d.Query(context.Background()).FilterInSubquery("id", sub, &subqueryOrder{}, "user_id").ToSQL(&subqueryUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `SELECT * FROM "subquery_users"  WHERE ( ("id" in (SELECT "user_id" FROM "subquery_orders"  WHERE ( ("user_id" <> $1) ))) ) LIMIT 50`
+	if sql != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, sql)
+	}
+	if len(values) != 1 || values[0] != "x" {
+		t.Errorf("invalid values: %#v", values)
+	}
+
+	sub = d.Query(context.Background())
+	sql, _, err = d.Query(context.Background()).FilterInSubquery("id", sub, &subqueryOrder{}, "user_id) or (1=1").ToSQL(&subqueryUser{})
+	if err == nil {
+		t.Errorf("expected an invalid column error, got %q", sql)
+	}
+}
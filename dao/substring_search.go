@@ -0,0 +1,106 @@
+package dao
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/ansel1/merry"
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// substringSearchExpr concatenates the columns into the searched text. The expression is the same as the one indexed
+// with AddTrigramIndex(), so that postgres can use the index. The columns must be text (or varchar), casts of other
+// types aren't immutable, so they can't be indexed.
+func substringSearchExpr(columns []string) (string, error) {
+	if len(columns) == 0 {
+		return "", merry.New("no substring search columns")
+	}
+	parts := make([]string, len(columns))
+	for n, col := range columns {
+		name, err := quoteColumn(col)
+		if err != nil {
+			return "", err
+		}
+		parts[n] = "coalesce(" + name + ", '')"
+	}
+	return "(" + strings.Join(parts, " || ' ' || ") + ")", nil
+}
+
+// SubstringSearch filters rows where the (text) columns contain all the (whitespace separated) words of the text, case
+// insensitive. An empty text doesn't filter. Use AddTrigramIndex() with the same columns for large tables.
+func (q *Query) SubstringSearch(text string, columns ...string) *Query {
+	expr, err := substringSearchExpr(columns)
+	if err != nil {
+		q.err = err
+		return q
+	}
+	for _, word := range strings.Fields(text) {
+		q.appendFilterExpressionAndValues("substring-search", expr+" ilike ?", "%"+likeEscaper.Replace(word)+"%")
+	}
+	return q
+}
+
+// SimilaritySearch filters rows with (text) columns similar to the text (the pg_trgm `%` operator, see the pg_trgm.similarity_threshold
+// setting), it's tolerant to typos. An empty text doesn't filter.
+func (q *Query) SimilaritySearch(text string, columns ...string) *Query {
+	expr, err := substringSearchExpr(columns)
+	if err != nil {
+		q.err = err
+		return q
+	}
+	if strings.TrimSpace(text) != "" {
+		q.appendFilterExpressionAndValues("similarity-search", expr+" % ?", text)
+	}
+	return q
+}
+
+// OrderBySimilarity orders by the trigram similarity of the columns to the text, the most similar first.
+func (q *Query) OrderBySimilarity(text string, columns ...string) *Query {
+	expr, err := substringSearchExpr(columns)
+	if err != nil {
+		q.err = err
+		return q
+	}
+	return q.OrderByRawExpression("similarity("+expr+", ?) desc", text)
+}
+
+// AddTrigramIndex registers and creates (with the pg_trgm extension) a GIN trigram index for SubstringSearch(),
+// SimilaritySearch() and OrderBySimilarity() on the same columns (only registers, if SkipMigrations is set). The
+// columns must be string fields of the model.
+func (d *Dao) AddTrigramIndex(c context.Context, index string, model Model, columns ...string) error {
+	expr, err := substringSearchExpr(columns)
+	if err != nil {
+		return err
+	}
+	scope := d.metaDb().NewScope(model)
+	for _, col := range columns {
+		field, found := scope.FieldByName(col[strings.LastIndex(col, ".")+1:])
+		if !found {
+			return merry.New("unknown trigram index column").Appendf("%T column %s", model, col)
+		}
+		ty := field.Struct.Type
+		for ty.Kind() == reflect.Ptr {
+			ty = ty.Elem()
+		}
+		if ty.Kind() != reflect.String {
+			return merry.New("trigram index columns must be text").Appendf("%T column %s is %s", model, col, ty)
+		}
+	}
+	idx := d.registerIndex(IndexInfo{
+		Name:       index,
+		Table:      scope.TableName(),
+		Columns:    columns,
+		Method:     "gin",
+		OpClass:    "gin_trgm_ops",
+		Expression: expr,
+	})
+	if d.SkipMigrations {
+		return nil
+	}
+	if _, err := d.Exec(c, "CREATE EXTENSION IF NOT EXISTS pg_trgm"); err != nil {
+		return merry.Wrap(err).Append("creating pg_trgm extension")
+	}
+	return d.createIndex(idx)
+}
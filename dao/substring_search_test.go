@@ -0,0 +1,43 @@
+package dao
+
+import (
+	"context"
+	"testing"
+)
+
+type substringSearchModel struct {
+	BaseModel
+	Email    string
+	Nickname *string
+	Age      int
+}
+
+func TestAddTrigramIndex(t *testing.T) {
+	t.Parallel()
+
+	c := context.Background()
+	d := New("1", "postgres", "", &substringSearchModel{})
+	d.SkipMigrations = true
+	if err := d.AddTrigramIndex(c, "ix_trgm", &substringSearchModel{}, "email", "substring_search_models.nickname"); err != nil {
+		t.Fatal(err)
+	}
+	indexes := d.Indexes()
+	expected := `(coalesce("email", '') || ' ' || coalesce("substring_search_models"."nickname", ''))`
+	if len(indexes) != 1 || indexes[0].Expression != expected {
+		t.Errorf("expected %s, got %+v", expected, indexes)
+	}
+
+	for _, col := range []string{"age", "nope"} {
+		if err := d.AddTrigramIndex(c, "ix_trgm_"+col, &substringSearchModel{}, col); err == nil {
+			t.Errorf("expected an error for %s", col)
+		}
+	}
+
+	sql, _, err := d.Query(c).SubstringSearch("a", "email").ToSQL(&substringSearchModel{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expectedSQL := `SELECT * FROM "substring_search_models"  WHERE ( ((coalesce("email", '')) ilike $1) ) LIMIT 50`; sql != expectedSQL {
+		t.Errorf("expected\n%s\ngot\n%s", expectedSQL, sql)
+	}
+}
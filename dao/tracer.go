@@ -0,0 +1,97 @@
+package dao
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Span attributes, named after the OpenTelemetry semantic conventions for database calls.
+const (
+	SpanAttrOperation = "db.operation"
+	SpanAttrTable     = "db.sql.table"
+	SpanAttrStatement = "db.statement"
+	SpanAttrRows      = "db.rows"
+)
+
+type Span interface {
+	SetAttribute(key string, value interface{})
+	End(err error)
+}
+
+// Tracer (if set on Dao) is called on every Dao and Query database operation.
+type Tracer interface {
+	StartSpan(c context.Context, name string, attrs map[string]interface{}) Span
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value interface{}) {}
+func (noopSpan) End(err error)                              {}
+
+func startSpan(c context.Context, tracer Tracer, db *gorm.DB, operation string, model interface{}, statement string) Span {
+	if tracer == nil {
+		return noopSpan{}
+	}
+	attrs := map[string]interface{}{
+		SpanAttrOperation: operation,
+	}
+	name := operation
+	if model != nil && db != nil {
+		table := db.NewScope(model).TableName()
+		attrs[SpanAttrTable] = table
+		name += " " + table
+	}
+	if statement != "" {
+		attrs[SpanAttrStatement] = statement
+	}
+	return tracer.StartSpan(c, name, attrs)
+}
+
+// endSpan ends the span, not found errors aren't span errors (as in the OpenTelemetry database conventions).
+func endSpan(span Span, err error, rows int64) {
+	if err != nil && IsRecordNotFound(err) {
+		err, rows = nil, 0
+	}
+	if rows >= 0 {
+		span.SetAttribute(SpanAttrRows, rows)
+	}
+	span.End(err)
+}
+
+// rawOperation extracts the operation (first keyword) from raw sql.
+func rawOperation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "RAW"
+	}
+	return strings.ToUpper(fields[0])
+}
+
+// iteratorSpan is ended when the iterator is closed (explicitly or after the last row).
+type iteratorSpan struct {
+	span Span
+	once sync.Once
+	rows int64
+}
+
+func newIteratorSpan(span Span) *iteratorSpan {
+	return &iteratorSpan{span: span}
+}
+
+func (is *iteratorSpan) next() {
+	if is != nil {
+		is.rows++
+	}
+}
+
+func (is *iteratorSpan) end(err error) {
+	if is == nil {
+		return
+	}
+	is.once.Do(func() {
+		endSpan(is.span, err, is.rows)
+	})
+}
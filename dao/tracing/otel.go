@@ -0,0 +1,253 @@
+// Package tracing implements dao.Tracer following the OpenTelemetry semantic conventions for database client spans.
+//
+// Finished spans are sent to an Exporter, which can forward them to an OpenTelemetry SDK/collector, or (in tests) just
+// keep them in memory (see InMemoryExporter).
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/coachbit/gorm-dao/dao"
+	utils "github.com/coachbit/gorm-dao/dao/daoutils"
+)
+
+const (
+	AttrDbSystem         = "db.system"
+	AttrDbName           = "db.name"
+	AttrDbUser           = "db.user"
+	AttrExceptionType    = "exception.type"
+	AttrExceptionMessage = "exception.message"
+
+	SpanKindClient = "client"
+
+	StatusUnset = "UNSET"
+	StatusOK    = "OK"
+	StatusError = "ERROR"
+
+	EventException = "exception"
+)
+
+type SpanContext struct {
+	TraceID string
+	SpanID  string
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != "" && sc.SpanID != ""
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext sets the parent span for all database spans started with the returned context.
+func ContextWithSpanContext(c context.Context, sc SpanContext) context.Context {
+	return context.WithValue(c, spanContextKey{}, sc)
+}
+
+func SpanContextFromContext(c context.Context) SpanContext {
+	if c == nil {
+		return SpanContext{}
+	}
+	sc, _ := c.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
+
+type Event struct {
+	Name       string
+	Time       time.Time
+	Attributes map[string]interface{}
+}
+
+// SpanData is a finished span.
+type SpanData struct {
+	TraceID       string
+	SpanID        string
+	ParentSpanID  string
+	Name          string
+	Kind          string
+	Start         time.Time
+	End           time.Time
+	Attributes    map[string]interface{}
+	Events        []Event
+	StatusCode    string
+	StatusMessage string
+}
+
+func (sd SpanData) Duration() time.Duration {
+	return sd.End.Sub(sd.Start)
+}
+
+type Exporter interface {
+	ExportSpan(c context.Context, span SpanData)
+}
+
+type ExporterFunc func(c context.Context, span SpanData)
+
+func (f ExporterFunc) ExportSpan(c context.Context, span SpanData) {
+	f(c, span)
+}
+
+var _ dao.Tracer = new(OTelTracer)
+
+type OTelTracer struct {
+	Exporter Exporter
+
+	// DbSystem is the `db.system` attribute, for example "postgresql"
+	DbSystem string
+	// DbName is the `db.name` attribute (optional)
+	DbName string
+	// DbUser is the `db.user` attribute (optional)
+	DbUser string
+
+	// ParentFromContext extracts the parent span of database spans, SpanContextFromContext() if nil. To nest database
+	// spans in OpenTelemetry request traces use the span context of the OpenTelemetry API:
+	//
+	//	tracer.ParentFromContext = func(c context.Context) tracing.SpanContext {
+	//		sc := trace.SpanContextFromContext(c)
+	//		if !sc.IsValid() {
+	//			return tracing.SpanContext{}
+	//		}
+	//		return tracing.SpanContext{TraceID: sc.TraceID().String(), SpanID: sc.SpanID().String()}
+	//	}
+	ParentFromContext func(c context.Context) SpanContext
+}
+
+// NewOTelTracer creates a tracer, dialect is the gorm dialect name (like "postgres").
+func NewOTelTracer(exporter Exporter, dialect, dbName string) *OTelTracer {
+	return &OTelTracer{
+		Exporter: exporter,
+		DbSystem: DbSystem(dialect),
+		DbName:   dbName,
+	}
+}
+
+// DbSystem maps gorm dialects to the `db.system` well known values.
+func DbSystem(dialect string) string {
+	switch dialect {
+	case "postgres":
+		return "postgresql"
+	case "sqlite3":
+		return "sqlite"
+	case "mysql":
+		return "mysql"
+	case "mssql":
+		return "mssql"
+	}
+	return "other_sql"
+}
+
+func (t *OTelTracer) StartSpan(c context.Context, name string, attrs map[string]interface{}) dao.Span {
+	parent := SpanContextFromContext(c)
+	if t.ParentFromContext != nil && c != nil {
+		parent = t.ParentFromContext(c)
+	}
+	s := &span{
+		c:        c,
+		exporter: t.Exporter,
+		data: SpanData{
+			TraceID:    parent.TraceID,
+			SpanID:     randomHexID(8),
+			Name:       name,
+			Kind:       SpanKindClient,
+			Start:      time.Now(),
+			Attributes: map[string]interface{}{},
+			StatusCode: StatusUnset,
+		},
+	}
+	if parent.IsValid() {
+		s.data.ParentSpanID = parent.SpanID
+	} else {
+		s.data.TraceID = randomHexID(16)
+	}
+	for k, v := range attrs {
+		s.data.Attributes[k] = v
+	}
+	if t.DbSystem != "" {
+		s.data.Attributes[AttrDbSystem] = t.DbSystem
+	}
+	if t.DbName != "" {
+		s.data.Attributes[AttrDbName] = t.DbName
+	}
+	if t.DbUser != "" {
+		s.data.Attributes[AttrDbUser] = t.DbUser
+	}
+	return s
+}
+
+type span struct {
+	c        context.Context
+	exporter Exporter
+
+	mutex sync.Mutex
+	ended bool
+	data  SpanData
+}
+
+func (s *span) SetAttribute(key string, value interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.data.Attributes[key] = value
+}
+
+func (s *span) End(err error) {
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	if err != nil {
+		s.data.StatusCode = StatusError
+		s.data.StatusMessage = err.Error()
+		s.data.Events = append(s.data.Events, Event{
+			Name: EventException,
+			Time: s.data.End,
+			Attributes: map[string]interface{}{
+				AttrExceptionType:    fmt.Sprintf("%T", err),
+				AttrExceptionMessage: err.Error(),
+			},
+		})
+	}
+	data := s.data
+	s.mutex.Unlock()
+
+	if s.exporter != nil {
+		s.exporter.ExportSpan(s.c, data)
+	}
+}
+
+func randomHexID(bytesLen int) string {
+	byts := make([]byte, bytesLen)
+	for n := range byts {
+		byts[n] = byte(utils.RandInt())
+	}
+	return hex.EncodeToString(byts)
+}
+
+// InMemoryExporter keeps all exported spans, useful as a stub exporter in tests.
+type InMemoryExporter struct {
+	mutex sync.Mutex
+	spans []SpanData
+}
+
+func (e *InMemoryExporter) ExportSpan(c context.Context, span SpanData) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+func (e *InMemoryExporter) Reset() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = nil
+}
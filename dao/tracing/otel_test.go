@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coachbit/gorm-dao/dao"
+)
+
+type tracedModel struct {
+	dao.BaseModel
+	Name string
+}
+
+func TestStartSpanParent(t *testing.T) {
+	t.Parallel()
+
+	parent := SpanContext{TraceID: "0af7651916cd43dd8448eb211c80319c", SpanID: "b7ad6b7169203331"}
+	custom := SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}
+	type customKey struct{}
+
+	for _, tc := range []struct {
+		name     string
+		c        context.Context
+		extract  func(c context.Context) SpanContext
+		expected SpanContext
+	}{
+		{name: "no parent", c: context.Background()},
+		{name: "context parent", c: ContextWithSpanContext(context.Background(), parent), expected: parent},
+		{
+			name:     "extracted parent",
+			c:        context.WithValue(context.Background(), customKey{}, custom),
+			extract:  func(c context.Context) SpanContext { sc, _ := c.Value(customKey{}).(SpanContext); return sc },
+			expected: custom,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			exporter := &InMemoryExporter{}
+			tracer := NewOTelTracer(exporter, "postgres", "app")
+			tracer.ParentFromContext = tc.extract
+			tracer.StartSpan(tc.c, "SELECT users", map[string]interface{}{dao.SpanAttrOperation: "SELECT"}).End(nil)
+
+			spans := exporter.Spans()
+			if len(spans) != 1 {
+				t.Fatalf("expected 1 span, got %d", len(spans))
+			}
+			span := spans[0]
+			if tc.expected.IsValid() {
+				if span.TraceID != tc.expected.TraceID || span.ParentSpanID != tc.expected.SpanID {
+					t.Errorf("expected parent %+v, got trace %s parent %s", tc.expected, span.TraceID, span.ParentSpanID)
+				}
+			} else if span.TraceID == "" || span.ParentSpanID != "" {
+				t.Errorf("expected a new trace, got trace %q parent %q", span.TraceID, span.ParentSpanID)
+			}
+			if span.Kind != SpanKindClient || span.StatusCode != StatusUnset {
+				t.Errorf("invalid kind/status: %s/%s", span.Kind, span.StatusCode)
+			}
+			if span.Attributes[AttrDbSystem] != "postgresql" || span.Attributes[AttrDbName] != "app" {
+				t.Errorf("invalid attributes: %#v", span.Attributes)
+			}
+		})
+	}
+}
+
+func TestQuerySpan(t *testing.T) {
+	t.Parallel()
+
+	exporter := &InMemoryExporter{}
+	d := dao.New("1", "postgres", "", &tracedModel{})
+	d.Tracer = NewOTelTracer(exporter, "postgres", "")
+
+	parent := SpanContext{TraceID: "0af7651916cd43dd8448eb211c80319c", SpanID: "b7ad6b7169203331"}
+	c := ContextWithSpanContext(context.Background(), parent)
+	// not initialized, so the query fails with dao.ErrOffline
+	if err := d.Query(c).Filter("name", "=", "x").First(&tracedModel{}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	spans := exporter.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "SELECT traced_models" || span.TraceID != parent.TraceID || span.ParentSpanID != parent.SpanID {
+		t.Errorf("invalid span: %+v", span)
+	}
+	if span.StatusCode != StatusError || len(span.Events) != 1 || span.Events[0].Name != EventException {
+		t.Errorf("expected error status with exception event: %+v", span)
+	}
+	if span.Attributes[dao.SpanAttrTable] != "traced_models" || span.Attributes[dao.SpanAttrOperation] != "SELECT" {
+		t.Errorf("invalid attributes: %#v", span.Attributes)
+	}
+	expectedSQL := `SELECT * FROM "traced_models"  WHERE ( ("name" = $1) ) ORDER BY "traced_models"."id" ASC LIMIT 1`
+	if span.Attributes[dao.SpanAttrStatement] != expectedSQL {
+		t.Errorf("expected statement %q, got %q", expectedSQL, span.Attributes[dao.SpanAttrStatement])
+	}
+	if _, found := span.Attributes[dao.SpanAttrRows]; found {
+		t.Errorf("unexpected rows on error: %#v", span.Attributes)
+	}
+}
@@ -0,0 +1,233 @@
+package dao
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/gofrs/uuid"
+)
+
+// FilterOperator is an operator usable in request parameters (`status=active`, `created_at[lt]=2024-01-01`).
+type FilterOperator string
+
+const (
+	FilterEq  FilterOperator = "eq"
+	FilterNe  FilterOperator = "ne"
+	FilterLt  FilterOperator = "lt"
+	FilterLte FilterOperator = "lte"
+	FilterGt  FilterOperator = "gt"
+	FilterGte FilterOperator = "gte"
+	// FilterIn values are comma separated (`status[in]=active,trial`) or repeated parameters
+	FilterIn FilterOperator = "in"
+	// FilterLike is a case insensitive substring match (`%` and `_` aren't wildcards), only for FilterString fields
+	FilterLike FilterOperator = "like"
+	// FilterIsNull is `is null` for true and `is not null` for false
+	FilterIsNull FilterOperator = "isnull"
+)
+
+var filterOperatorSQL = map[FilterOperator]string{
+	FilterEq: "=", FilterNe: "<>", FilterLt: "<", FilterLte: "<=", FilterGt: ">", FilterGte: ">=",
+}
+
+// FilterType is the type request parameter values are parsed to.
+type FilterType int
+
+const (
+	FilterString FilterType = iota
+	FilterInt
+	FilterFloat
+	FilterBool
+	// FilterTime values are RFC 3339 timestamps or dates (2006-01-02)
+	FilterTime
+	FilterUUID
+)
+
+// FilterField is a filter allowed in request parameters.
+type FilterField struct {
+	// Column is the filtered column, the parameter name if empty
+	Column string
+	Type   FilterType
+	// Operators are the allowed operators, only FilterEq if empty
+	Operators []FilterOperator
+}
+
+// URLSpec declares which request parameters FromURLValues() accepts.
+type URLSpec struct {
+	// Filters by parameter name
+	Filters map[string]FilterField
+	// Sort are the allowed sort columns, see SortFromRequest()
+	Sort []string
+	// DefaultSort is used if there is no sort parameter
+	DefaultSort string
+	// MaxPageSize limits the size parameter (unlimited if 0)
+	MaxPageSize int
+
+	// PageParam, SizeParam and SortParam are the parameter names, "page", "size" and "sort" if empty
+	PageParam string
+	SizeParam string
+	SortParam string
+}
+
+// filterParamRegexp matches filter parameters with an operator (`created_at[lt]`)
+var filterParamRegexp = regexp.MustCompile(`^(\w+)\[(\w+)\]$`)
+
+// FromURLValues applies the filters, ordering and paging of request parameters like
+// `?page=2&size=20&sort=-created_at&status=active&created_at[gte]=2024-01-01`. Pages are zero based. Parameters which
+// aren't in the spec are ignored, invalid ones (unknown operators, unparsable values...) are query errors with the
+// HTTP code 400.
+func (q *Query) FromURLValues(values url.Values, spec URLSpec) *Query {
+	pageParam := stringOrDefault(spec.PageParam, "page")
+	sizeParam := stringOrDefault(spec.SizeParam, "size")
+	sortParam := stringOrDefault(spec.SortParam, "sort")
+
+	params := make([]string, 0, len(values))
+	for param := range values {
+		params = append(params, param)
+	}
+	// deterministic sql
+	sort.Strings(params)
+	for _, param := range params {
+		name, op := param, FilterEq
+		if match := filterParamRegexp.FindStringSubmatch(param); len(match) > 0 {
+			name, op = match[1], FilterOperator(strings.ToLower(match[2]))
+			if _, found := spec.Filters[name]; !found {
+				q.err = firstErr(q.err, badRequest(merry.New("unknown filter").Appendf("parameter: %s", param)))
+				return q
+			}
+		}
+		field, found := spec.Filters[name]
+		if !found {
+			continue
+		}
+		if err := q.filterFromURLValue(name, op, field, values[param]); err != nil {
+			q.err = firstErr(q.err, badRequest(err))
+			return q
+		}
+	}
+
+	if sortStr := stringOrDefault(values.Get(sortParam), spec.DefaultSort); sortStr != "" {
+		q.SortFromRequest(sortStr, spec.Sort...)
+	}
+	if sizeStr := values.Get(sizeParam); sizeStr != "" {
+		size, err := strconv.Atoi(sizeStr)
+		if err != nil || size <= 0 || (spec.MaxPageSize > 0 && size > spec.MaxPageSize) {
+			q.err = firstErr(q.err, badRequest(merry.New("invalid page size").Appendf("%s: %s", sizeParam, sizeStr)))
+			return q
+		}
+		q.WithPageSize(size)
+	}
+	if pageStr := values.Get(pageParam); pageStr != "" {
+		page, err := strconv.Atoi(pageStr)
+		if err != nil || page < 0 {
+			q.err = firstErr(q.err, badRequest(merry.New("invalid page").Appendf("%s: %s", pageParam, pageStr)))
+			return q
+		}
+		q.WithPageNo(page)
+	}
+	return q
+}
+
+func (q *Query) filterFromURLValue(name string, op FilterOperator, field FilterField, strs []string) error {
+	allowed := field.Operators
+	if len(allowed) == 0 {
+		allowed = []FilterOperator{FilterEq}
+	}
+	if !containsFilterOperator(allowed, op) {
+		return merry.New("filter operator not allowed").Appendf("%s[%s]", name, op)
+	}
+	column := stringOrDefault(field.Column, name)
+
+	if op == FilterIn {
+		var values []interface{}
+		for _, str := range strs {
+			for _, part := range strings.Split(str, ",") {
+				val, err := parseFilterValue(field.Type, strings.TrimSpace(part))
+				if err != nil {
+					return merry.Wrap(err).Appendf("filter %s", name)
+				}
+				values = append(values, val)
+			}
+		}
+		q.FilterIn(column, values...)
+		return nil
+	}
+
+	if len(strs) != 1 {
+		return merry.New("multiple filter values").Appendf("%s[%s]", name, op)
+	}
+	switch op {
+	case FilterIsNull:
+		isNull, err := strconv.ParseBool(strs[0])
+		if err != nil {
+			return merry.Wrap(err).Appendf("filter %s", name)
+		}
+		if isNull {
+			q.appendFilterExpressionAndValues("null", q.column(column)+" is null")
+		} else {
+			q.FilterIsNotNull(column)
+		}
+	case FilterLike:
+		if field.Type != FilterString {
+			return merry.New("like filter on a non string field").Appendf("%s[%s]", name, op)
+		}
+		q.Filter(column, "ilike", "%"+likeEscaper.Replace(strs[0])+"%")
+	default:
+		operator, found := filterOperatorSQL[op]
+		if !found {
+			return merry.New("invalid filter operator").Appendf("%s[%s]", name, op)
+		}
+		val, err := parseFilterValue(field.Type, strs[0])
+		if err != nil {
+			return merry.Wrap(err).Appendf("filter %s", name)
+		}
+		q.Filter(column, operator, val)
+	}
+	return nil
+}
+
+func parseFilterValue(ty FilterType, str string) (interface{}, error) {
+	switch ty {
+	case FilterString:
+		return str, nil
+	case FilterInt:
+		return strconv.ParseInt(str, 10, 64)
+	case FilterFloat:
+		return strconv.ParseFloat(str, 64)
+	case FilterBool:
+		return strconv.ParseBool(str)
+	case FilterTime:
+		if t, err := time.Parse(time.RFC3339, str); err == nil {
+			return t, nil
+		}
+		return time.Parse("2006-01-02", str)
+	case FilterUUID:
+		return uuid.FromString(str)
+	}
+	return nil, merry.New("invalid filter type").Appendf("type: %d", ty)
+}
+
+func containsFilterOperator(ops []FilterOperator, op FilterOperator) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+func stringOrDefault(str, dflt string) string {
+	if str == "" {
+		return dflt
+	}
+	return str
+}
+
+func badRequest(err error) error {
+	return merry.Wrap(err).WithHTTPCode(http.StatusBadRequest)
+}
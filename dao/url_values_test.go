@@ -0,0 +1,194 @@
+package dao
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/gofrs/uuid"
+)
+
+type urlValuesModel struct {
+	BaseModel
+	Email     string
+	Age       int
+	LastLogin *time.Time
+}
+
+var urlValuesSpec = URLSpec{
+	Filters: map[string]FilterField{
+		"email":      {Operators: []FilterOperator{FilterEq, FilterLike, FilterIn}},
+		"age":        {Type: FilterInt, Operators: []FilterOperator{FilterGte, FilterLike}},
+		"last_login": {Type: FilterTime, Operators: []FilterOperator{FilterLt, FilterIsNull}},
+		"login":      {Column: "last_login", Type: FilterTime, Operators: []FilterOperator{FilterGt}},
+	},
+	Sort:        []string{"created_at", "email", "rank"},
+	DefaultSort: "-created_at",
+	MaxPageSize: 100,
+}
+
+func TestFromURLValues(t *testing.T) {
+	t.Parallel()
+
+	d := New("1", "postgres", "", &urlValuesModel{})
+	for _, tc := range []struct {
+		name   string
+		query  string
+		sql    string
+		values []interface{}
+		err    bool
+	}{
+		{
+			name:  "defaults",
+			query: "other=1",
+			sql:   `SELECT * FROM "url_values_models"   ORDER BY "created_at" desc LIMIT 50`,
+		},
+		{
+			name:   "filters, sort and page",
+			query:  "page=2&size=20&sort=-email,RANK&email=a_b&age[gte]=18&last_login[isnull]=false",
+			sql:    `SELECT * FROM "url_values_models"  WHERE ( ("age" >= $1)  and  ("email" = $2)  and  ("last_login" is not null) ) ORDER BY "email" desc,"rank" asc LIMIT 20 OFFSET 40`,
+			values: []interface{}{int64(18), "a_b"},
+		},
+		{
+			name:   "in, like and column",
+			query:  "email[in]=a,b&email[in]=c&login[gt]=2024-01-02",
+			sql:    `SELECT * FROM "url_values_models"  WHERE ( ("email" in ($1,$2,$3))  and  ("last_login" > $4) ) ORDER BY "created_at" desc LIMIT 50`,
+			values: []interface{}{"a", "b", "c", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:   "like",
+			query:  "email[like]=5%25_",
+			sql:    `SELECT * FROM "url_values_models"  WHERE ( ("email" ilike $1) ) ORDER BY "created_at" desc LIMIT 50`,
+			values: []interface{}{`%5\%\_%`},
+		},
+		{name: "page size too big", query: "size=1000", err: true},
+		{name: "invalid page", query: "page=x", err: true},
+		{name: "negative page", query: "page=-1", err: true},
+		{name: "operator not allowed", query: "email[lt]=x", err: true},
+		{name: "unknown filter", query: "foo[eq]=1", err: true},
+		{name: "invalid value", query: "age[gte]=old", err: true},
+		{name: "like on int", query: "age[like]=5", err: true},
+		{name: "multiple values", query: "email=a&email=b", err: true},
+		{name: "sort not allowed", query: "sort=age", err: true},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			values, err := url.ParseQuery(tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sql, vals, err := d.Query(context.Background()).FromURLValues(values, urlValuesSpec).ToSQL(&urlValuesModel{})
+			if tc.err {
+				if err == nil || merry.HTTPCode(err) != http.StatusBadRequest {
+					t.Fatalf("expected bad request, got %v (%q)", err, sql)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != tc.sql {
+				t.Errorf("sql: expected\n%s\ngot\n%s", tc.sql, sql)
+			}
+			if len(vals) != 0 || len(tc.values) != 0 {
+				if !reflect.DeepEqual(vals, tc.values) {
+					t.Errorf("values: expected %#v, got %#v", tc.values, vals)
+				}
+			}
+		})
+	}
+}
+
+func TestFromURLValuesKeepsFirstError(t *testing.T) {
+	t.Parallel()
+
+	d := New("1", "postgres", "", &urlValuesModel{})
+	first := merry.New("first")
+	q := d.Query(context.Background())
+	q.err = first
+	if err := q.FromURLValues(url.Values{"page": {"x"}}, urlValuesSpec).err; err != first {
+		t.Errorf("expected the first error, got %v", err)
+	}
+}
+
+func TestSortFromRequest(t *testing.T) {
+	t.Parallel()
+
+	d := New("1", "postgres", "", &urlValuesModel{})
+	for _, tc := range []struct {
+		name    string
+		param   string
+		allowed []string
+		sql     string
+		err     bool
+	}{
+		{name: "known columns", param: "-created_at, Email,+url_values_models.id", sql: `ORDER BY "created_at" desc,"email" asc,"url_values_models"."id" asc`},
+		{name: "empty parts", param: ",age,", sql: `ORDER BY "age" asc`},
+		{name: "unknown column", param: "nope", err: true},
+		{name: "allowed alias", param: "-rank", allowed: []string{"RANK"}, sql: `ORDER BY "rank" desc`},
+		{name: "not allowed", param: "age", allowed: []string{"email"}, err: true},
+		{name: "injection", param: "email;drop table x", allowed: []string{"email;drop table x"}, err: true},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			sql, _, err := d.Query(context.Background()).SortFromRequest(tc.param, tc.allowed...).ToSQL(&urlValuesModel{})
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error, got %q", sql)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := `SELECT * FROM "url_values_models"   ` + tc.sql + ` LIMIT 50`
+			if sql != expected {
+				t.Errorf("expected\n%s\ngot\n%s", expected, sql)
+			}
+		})
+	}
+}
+
+func TestParseFilterValue(t *testing.T) {
+	t.Parallel()
+
+	id := uuid.Must(uuid.NewV4())
+	for _, tc := range []struct {
+		ty       FilterType
+		str      string
+		expected interface{}
+		err      bool
+	}{
+		{ty: FilterString, str: "x", expected: "x"},
+		{ty: FilterInt, str: "-7", expected: int64(-7)},
+		{ty: FilterInt, str: "7.5", err: true},
+		{ty: FilterFloat, str: "7.5", expected: 7.5},
+		{ty: FilterBool, str: "true", expected: true},
+		{ty: FilterBool, str: "yes", err: true},
+		{ty: FilterTime, str: "2024-01-02T03:04:05Z", expected: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{ty: FilterTime, str: "2024-01-02", expected: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{ty: FilterTime, str: "yesterday", err: true},
+		{ty: FilterUUID, str: id.String(), expected: id},
+		{ty: FilterUUID, str: "x", err: true},
+		{ty: FilterType(-1), str: "x", err: true},
+	} {
+		val, err := parseFilterValue(tc.ty, tc.str)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%d %q: expected error, got %#v", tc.ty, tc.str, val)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d %q: %v", tc.ty, tc.str, err)
+		} else if !reflect.DeepEqual(val, tc.expected) {
+			t.Errorf("%d %q: expected %#v, got %#v", tc.ty, tc.str, tc.expected, val)
+		}
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/coachbit/gorm-dao
 
-go 1.17
+go 1.21
 
 require (
 	github.com/ansel1/merry v1.6.2